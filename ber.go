@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+var ErrInvalidBERFilter = errors.New("invalid BER filter")
+
+// Context-specific tags of the Filter CHOICE and its components in the LDAP
+// ASN.1 definition of a search request. See [RFC 4511, section 4.5.1].
+//
+// [RFC 4511, section 4.5.1]: https://datatracker.ietf.org/doc/html/rfc4511#section-4.5.1
+const (
+	berFilterAnd             ber.Tag = 0
+	berFilterOr              ber.Tag = 1
+	berFilterNot             ber.Tag = 2
+	berFilterEquality        ber.Tag = 3
+	berFilterSubstrings      ber.Tag = 4
+	berFilterGreaterOrEqual  ber.Tag = 5
+	berFilterLessOrEqual     ber.Tag = 6
+	berFilterPresent         ber.Tag = 7
+	berFilterApprox          ber.Tag = 8
+	berFilterExtensibleMatch ber.Tag = 9
+
+	berSubstringInitial ber.Tag = 0
+	berSubstringAny     ber.Tag = 1
+	berSubstringFinal   ber.Tag = 2
+
+	berMatchingRule ber.Tag = 1
+	berMatchType    ber.Tag = 2
+	berMatchValue   ber.Tag = 3
+	berDNAttributes ber.Tag = 4
+)
+
+// NewFilterFromBER converts a BER-encoded LDAP filter, as it is sent on the
+// wire in a search request, into a [FilterNode] AST. It produces the same
+// AST as [Parse] does for the string form of the filter. The value of an
+// extensible match with a substrings matching rule is a substring assertion,
+// in which a literal '*' is sent escaped as \2A, as Parse keeps an escaped
+// '*'. If the packet is not a valid filter, an error is returned with a nil
+// FilterNode.
+func NewFilterFromBER(p *ber.Packet) (FilterNode, error) {
+	if p.ClassType != ber.ClassContext {
+		return nil, fmt.Errorf("%w: unexpected class: %v", ErrInvalidBERFilter, p.ClassType)
+	}
+
+	switch p.Tag {
+	case berFilterAnd, berFilterOr:
+		if len(p.Children) == 0 {
+			return nil, fmt.Errorf("%w: and/or filter with no subfilters", ErrInvalidBERFilter)
+		}
+		nodes := make([]FilterNode, 0, len(p.Children))
+		for _, child := range p.Children {
+			n, err := NewFilterFromBER(child)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		if p.Tag == berFilterAnd {
+			return &And{Nodes: nodes}, nil
+		}
+		return &Or{Nodes: nodes}, nil
+
+	case berFilterNot:
+		if len(p.Children) != 1 {
+			return nil, fmt.Errorf("%w: not filter with %d subfilters", ErrInvalidBERFilter, len(p.Children))
+		}
+		n, err := NewFilterFromBER(p.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Node: n}, nil
+
+	case berFilterEquality, berFilterGreaterOrEqual, berFilterLessOrEqual, berFilterApprox:
+		attr, value, err := berAttributeValueAssertion(p)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Tag {
+		case berFilterEquality:
+			return &Equality{Attr: attr, Value: value}, nil
+		case berFilterGreaterOrEqual:
+			return &GreaterOrEqual{Attr: attr, Value: value}, nil
+		case berFilterLessOrEqual:
+			return &LessOrEqual{Attr: attr, Value: value}, nil
+		default:
+			return &Approx{Attr: attr, Value: value}, nil
+		}
+
+	case berFilterSubstrings:
+		return berSubstrings(p)
+
+	case berFilterPresent:
+		attr := berString(p)
+		if attr == "" {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBERFilter, ErrEmptyAttrName)
+		}
+		return &Presence{Attr: attr}, nil
+
+	case berFilterExtensibleMatch:
+		return berExtensibleMatch(p)
+	}
+
+	return nil, fmt.Errorf("%w: unknown filter tag: %d", ErrInvalidBERFilter, p.Tag)
+}
+
+// berAttributeValueAssertion returns the attribute description and assertion
+// value of an AttributeValueAssertion packet.
+func berAttributeValueAssertion(p *ber.Packet) (string, string, error) {
+	if len(p.Children) != 2 {
+		return "", "", fmt.Errorf("%w: attribute value assertion with %d elements", ErrInvalidBERFilter, len(p.Children))
+	}
+	attr, value := berString(p.Children[0]), berString(p.Children[1])
+	if attr == "" {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidBERFilter, ErrEmptyAttrName)
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidBERFilter, ErrEmptyAttrValue)
+	}
+	return attr, value, nil
+}
+
+func berSubstrings(p *ber.Packet) (FilterNode, error) {
+	if len(p.Children) != 2 {
+		return nil, fmt.Errorf("%w: substring filter with %d elements", ErrInvalidBERFilter, len(p.Children))
+	}
+	f := &Substring{Attr: berString(p.Children[0])}
+	if f.Attr == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBERFilter, ErrEmptyAttrName)
+	}
+	subs := p.Children[1].Children
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("%w: substring filter with no substrings", ErrInvalidBERFilter)
+	}
+	for i, sub := range subs {
+		switch {
+		case sub.Tag == berSubstringInitial && i == 0:
+			f.Initial = berString(sub)
+		case sub.Tag == berSubstringAny:
+			f.Any = append(f.Any, berString(sub))
+		case sub.Tag == berSubstringFinal && i == len(subs)-1:
+			f.Final = berString(sub)
+		default:
+			return nil, fmt.Errorf("%w: unexpected substring tag %d at %d", ErrInvalidBERFilter, sub.Tag, i)
+		}
+	}
+	return f, nil
+}
+
+func berExtensibleMatch(p *ber.Packet) (FilterNode, error) {
+	f := &ExtensibleMatch{}
+	for _, child := range p.Children {
+		switch child.Tag {
+		case berMatchingRule:
+			f.Rule = berString(child)
+		case berMatchType:
+			f.Attr = berString(child)
+		case berMatchValue:
+			f.Value = berString(child)
+		case berDNAttributes:
+			b := child.Data.Bytes()
+			f.DNAttributes = len(b) > 0 && b[0] != 0
+		default:
+			return nil, fmt.Errorf("%w: unexpected extensible match tag %d", ErrInvalidBERFilter, child.Tag)
+		}
+	}
+	if f.Attr == "" && f.Rule == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBERFilter, ErrMissingRule)
+	}
+	if mr := LookupMatchingRule(f.Rule); mr != nil && mr.Usage == SubstringsRule {
+		// The value is a substring assertion. Encode it again as Parse
+		// does, so that escaped stars in it are kept in the same form.
+		f.Value = encodeSubstringAssertion(decodeSubstringAssertion(f.Value))
+	}
+	return f, nil
+}
+
+// berString returns the contents of a primitive packet as a string. The
+// contents are used rather than the decoded value, as context-specific
+// packets are not decoded into a value.
+func berString(p *ber.Packet) string {
+	if p.Data == nil {
+		return ""
+	}
+	return p.Data.String()
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/matryer/is"
+)
+
+func Test_FilterFromBER_RoundTrip(t *testing.T) {
+	testfunc := func(t *testing.T, filter string) { //nolint:thelper // not a helper
+		is := is.New(t)
+		expected, err := Parse(filter)
+		is.NoErr(err)
+
+		p, err := ldap.CompileFilter(filter)
+		is.NoErr(err)
+		n, err := NewFilterFromBER(p)
+		is.NoErr(err)
+		is.Equal(expected, n)
+
+		// Decode the encoded packet, as it would be received on the
+		// wire, and check that it converts the same.
+		p, err = ber.DecodePacketErr(p.Bytes())
+		is.NoErr(err)
+		n, err = NewFilterFromBER(p)
+		is.NoErr(err)
+		is.Equal(expected, n)
+	}
+
+	tests := []string{
+		"(present=*)",
+		"(eq=eqval)",
+		"(cn=John Smith)",
+		`(eq=a\29b\28)`,
+		`(eq=\2a)`,
+		`(eq=\5c\00)`,
+		`(eq=Lu\c4\8di\c4\87)`,
+		"(sub=jo*)",
+		"(sub=*son)",
+		"(sub=*mit*)",
+		"(sub=a*b*c*d)",
+		`(sub=\2a*\2a*\2a)`,
+		"(uidNumber>=10000)",
+		"(shadowExpire<=19000)",
+		"(cn~=jon smyth)",
+		"(ou:dn:=people)",
+		"(cn:caseExactMatch:=Foo)",
+		"(:dn:2.5.13.5:=Foo)",
+		"(:caseIgnoreMatch:=foo)",
+		"(cn;lang-en=eqval)",
+		"(2.5.4.3=eqval)",
+		"(&(eq=eqval))",
+		"(|(eq=eqval)(present=*))",
+		"(!(present=*))",
+		"(&(present=*)(|(eq=eqval)(!(present2=*))(eq=eqval2)))",
+		"(&(objectClass=posixAccount)(|(uid=jo*)(cn=*smith*))(uidNumber>=1000)(!(loginShell=/bin/false)))",
+	}
+
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) { testfunc(t, filter) })
+	}
+}
+
+// berPrimitive returns a context-specific primitive packet with the tag and
+// contents s.
+func berPrimitive(tag ber.Tag, s string) *ber.Packet {
+	return ber.NewString(ber.ClassContext, ber.TypePrimitive, tag, s, "")
+}
+
+// berConstructed returns a context-specific constructed packet with the tag
+// and children.
+func berConstructed(tag ber.Tag, children ...*ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, "")
+	for _, child := range children {
+		p.AppendChild(child)
+	}
+	return p
+}
+
+// berOctets returns an OCTET STRING packet with the contents s.
+func berOctets(s string) *ber.Packet {
+	return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s, "")
+}
+
+// berSubstringSeq returns the SEQUENCE of substrings of a substrings filter.
+func berSubstringSeq(subs ...*ber.Packet) *ber.Packet {
+	seq := ber.NewSequence("")
+	for _, sub := range subs {
+		seq.AppendChild(sub)
+	}
+	return seq
+}
+
+func Test_FilterFromBER(t *testing.T) {
+	type testcase struct {
+		name   string
+		packet *ber.Packet
+		want   FilterNode
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		got, err := NewFilterFromBER(tt.packet)
+		is.NoErr(err)
+		is.Equal(tt.want, got)
+
+		// Decode the encoded packet, as it would be received on the wire,
+		// and check that it converts the same.
+		p, err := ber.DecodePacketErr(tt.packet.Bytes())
+		is.NoErr(err)
+		got, err = NewFilterFromBER(p)
+		is.NoErr(err)
+		is.Equal(tt.want, got)
+	}
+
+	tests := []testcase{
+		{
+			name:   "present",
+			packet: berPrimitive(berFilterPresent, "cn"),
+			want:   &Presence{Attr: "cn"},
+		},
+		{
+			// Values are not escaped in BER, so characters special in
+			// the string form are taken literally.
+			name:   "equality special characters",
+			packet: berConstructed(berFilterEquality, berOctets("cn"), berOctets(`a*(b)\c`)),
+			want:   &Equality{Attr: "cn", Value: `a*(b)\c`},
+		},
+		{
+			name:   "equality binary",
+			packet: berConstructed(berFilterEquality, berOctets("cn"), berOctets("a\x00\xff")),
+			want:   &Equality{Attr: "cn", Value: "a\x00\xff"},
+		},
+		{
+			name:   "greater or equal",
+			packet: berConstructed(berFilterGreaterOrEqual, berOctets("uidNumber"), berOctets("1000")),
+			want:   &GreaterOrEqual{Attr: "uidNumber", Value: "1000"},
+		},
+		{
+			name:   "less or equal",
+			packet: berConstructed(berFilterLessOrEqual, berOctets("uidNumber"), berOctets("1000")),
+			want:   &LessOrEqual{Attr: "uidNumber", Value: "1000"},
+		},
+		{
+			name:   "approx",
+			packet: berConstructed(berFilterApprox, berOctets("cn"), berOctets("jon")),
+			want:   &Approx{Attr: "cn", Value: "jon"},
+		},
+		{
+			name: "substrings",
+			packet: berConstructed(berFilterSubstrings, berOctets("cn"), berSubstringSeq(
+				berPrimitive(berSubstringInitial, "jo"),
+				berPrimitive(berSubstringAny, "h"),
+				berPrimitive(berSubstringAny, "*"),
+				berPrimitive(berSubstringFinal, "n"),
+			)),
+			want: &Substring{Attr: "cn", Initial: "jo", Any: []string{"h", "*"}, Final: "n"},
+		},
+		{
+			name:   "substrings final only",
+			packet: berConstructed(berFilterSubstrings, berOctets("cn"), berSubstringSeq(berPrimitive(berSubstringFinal, "son"))),
+			want:   &Substring{Attr: "cn", Final: "son"},
+		},
+		{
+			name: "extensible dn attributes",
+			packet: berConstructed(berFilterExtensibleMatch,
+				berPrimitive(berMatchingRule, "caseExactMatch"),
+				berPrimitive(berMatchType, "ou"),
+				berPrimitive(berMatchValue, "People"),
+				ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, berDNAttributes, true, ""),
+			),
+			want: &ExtensibleMatch{Attr: "ou", Rule: "caseExactMatch", DNAttributes: true, Value: "People"},
+		},
+		{
+			name: "extensible rule only",
+			packet: berConstructed(berFilterExtensibleMatch,
+				berPrimitive(berMatchingRule, "2.5.13.2"),
+				berPrimitive(berMatchValue, "foo"),
+				ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, berDNAttributes, false, ""),
+			),
+			want: &ExtensibleMatch{Rule: "2.5.13.2", Value: "foo"},
+		},
+		{
+			name: "nested",
+			packet: berConstructed(berFilterAnd,
+				berConstructed(berFilterEquality, berOctets("objectClass"), berOctets("posixAccount")),
+				berConstructed(berFilterOr,
+					berPrimitive(berFilterPresent, "mail"),
+					berConstructed(berFilterNot, berConstructed(berFilterEquality, berOctets("loginShell"), berOctets("/bin/false"))),
+				),
+			),
+			want: &And{Nodes: []FilterNode{
+				&Equality{Attr: "objectClass", Value: "posixAccount"},
+				&Or{Nodes: []FilterNode{
+					&Presence{Attr: "mail"},
+					&Not{Node: &Equality{Attr: "loginShell", Value: "/bin/false"}},
+				}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_FilterFromBER_SubstringsRule(t *testing.T) {
+	type testcase struct {
+		filter string
+		value  string // assertion value of the filter, as sent in BER
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		expected, err := Parse(tt.filter)
+		is.NoErr(err)
+		p := berConstructed(berFilterExtensibleMatch,
+			berPrimitive(berMatchingRule, "caseIgnoreSubstringsMatch"),
+			berPrimitive(berMatchType, "cn"),
+			berPrimitive(berMatchValue, tt.value),
+		)
+		n, err := NewFilterFromBER(p)
+		is.NoErr(err)
+		is.Equal(expected, n)
+	}
+
+	tests := []testcase{
+		{filter: "(cn:caseIgnoreSubstringsMatch:=J*Smi*)", value: "J*Smi*"},
+		{filter: `(cn:caseIgnoreSubstringsMatch:=a\2ab*c)`, value: `a\2Ab*c`},
+		{filter: `(cn:caseIgnoreSubstringsMatch:=a\2ab*c)`, value: `a\2ab*c`},
+		{filter: `(cn:caseIgnoreSubstringsMatch:=a\5cb*)`, value: `a\5Cb*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.value, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_FilterFromBER_Fail(t *testing.T) {
+	type testcase struct {
+		name   string
+		packet *ber.Packet
+		err    error
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		_, err := NewFilterFromBER(tt.packet)
+		is.True(errors.Is(err, tt.err))
+	}
+
+	tests := []testcase{
+		{
+			name:   "not context class",
+			packet: berOctets("cn"),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "unknown tag",
+			packet: berConstructed(10),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "empty and",
+			packet: berConstructed(berFilterAnd),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "not with two subfilters",
+			packet: berConstructed(berFilterNot, berPrimitive(berFilterPresent, "a"), berPrimitive(berFilterPresent, "b")),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "invalid subfilter",
+			packet: berConstructed(berFilterOr, berOctets("cn")),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "empty present",
+			packet: berPrimitive(berFilterPresent, ""),
+			err:    ErrEmptyAttrName,
+		},
+		{
+			name:   "short equality",
+			packet: berConstructed(berFilterEquality, berOctets("cn")),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "empty equality value",
+			packet: berConstructed(berFilterEquality, berOctets("cn"), berOctets("")),
+			err:    ErrEmptyAttrValue,
+		},
+		{
+			name:   "no substrings",
+			packet: berConstructed(berFilterSubstrings, berOctets("cn"), berSubstringSeq()),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "final substring not last",
+			packet: berConstructed(berFilterSubstrings, berOctets("cn"), berSubstringSeq(berPrimitive(berSubstringFinal, "a"), berPrimitive(berSubstringAny, "b"))),
+			err:    ErrInvalidBERFilter,
+		},
+		{
+			name:   "extensible no type or rule",
+			packet: berConstructed(berFilterExtensibleMatch, berPrimitive(berMatchValue, "a")),
+			err:    ErrMissingRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/md5" //nolint:gosec // may be weak, but we use it
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedCrypt is returned when checking a password against a crypt
+// hash of a method other than those of [crypt].
+var ErrUnsupportedCrypt = errors.New("unsupported crypt method")
+
+// cryptAlphabet is the alphabet of the base-64 encoding used by crypt, in
+// which the hashes are encoded least significant bits first.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// crypt hashes password with the method, salt and parameters of the crypt
+// hash setting, as the crypt(3) function of glibc does for the methods it
+// uses by default, and returns the hash in the same form as setting. The
+// supported methods are:
+//
+//   - $1$: MD5-crypt, as described by [FreeBSD]
+//   - $5$: SHA-256-crypt, as described in [Unix crypt using SHA-256 and SHA-512]
+//   - $6$: SHA-512-crypt, as described in [Unix crypt using SHA-256 and SHA-512]
+//
+// setting may be a hash itself, so a password is checked by comparing its
+// hash with the hash it is hashed with.
+//
+// [FreeBSD]: https://cgit.freebsd.org/src/tree/lib/libcrypt/crypt-md5.c
+// [Unix crypt using SHA-256 and SHA-512]: https://www.akkadia.org/drepper/SHA-crypt.txt
+func crypt(password, setting string) (string, error) {
+	switch {
+	case strings.HasPrefix(setting, "$1$"):
+		return md5Crypt(password, setting[len("$1$"):]), nil
+	case strings.HasPrefix(setting, "$5$"):
+		return shaCrypt(password, "$5$", setting[len("$5$"):], sha256.New, sha256CryptOrder)
+	case strings.HasPrefix(setting, "$6$"):
+		return shaCrypt(password, "$6$", setting[len("$6$"):], sha512.New, sha512CryptOrder)
+	}
+	return "", ErrUnsupportedCrypt
+}
+
+// cryptSalt returns the salt at the start of setting, up to the first "$"
+// and at most maxLen bytes.
+func cryptSalt(setting string, maxLen int) string {
+	salt, _, _ := strings.Cut(setting, "$")
+	return salt[:min(len(salt), maxLen)]
+}
+
+// cryptEncode encodes sum with the crypt base-64 encoding, taking its bytes
+// in groups of three in the order of the indexes in order. The last group
+// may be shorter.
+func cryptEncode(sum []byte, order [][]int) string {
+	var b strings.Builder
+	for _, group := range order {
+		var v uint
+		for _, i := range group {
+			v = v<<8 | uint(sum[i])
+		}
+		for range len(group) + 1 {
+			b.WriteByte(cryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	return b.String()
+}
+
+// md5CryptOrder is the order the bytes of the MD5-crypt hash are encoded in.
+var md5CryptOrder = [][]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}, {11}}
+
+// md5Crypt returns the MD5-crypt hash of password with the salt at the start
+// of setting, which follows "$1$".
+func md5Crypt(password, setting string) string {
+	const magic = "$1$"
+	salt := cryptSalt(setting, 8)
+	pw := []byte(password)
+
+	alt := md5.New() //nolint:gosec // may be weak, but we use it
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	h := md5.New() //nolint:gosec // may be weak, but we use it
+	h.Write(pw)
+	h.Write([]byte(magic + salt))
+	for n := len(pw); n > 0; n -= md5.Size {
+		h.Write(altSum[:min(n, md5.Size)])
+	}
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := range 1000 {
+		h := md5.New() //nolint:gosec // may be weak, but we use it
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	return magic + salt + "$" + cryptEncode(sum, md5CryptOrder)
+}
+
+// sha256CryptOrder and sha512CryptOrder are the orders the bytes of the
+// SHA-crypt hashes are encoded in.
+var (
+	sha256CryptOrder = [][]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+		{31, 30},
+	}
+	sha512CryptOrder = [][]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41}, {63},
+	}
+)
+
+// SHA-crypt rounds are limited to this range, and default to
+// shaCryptDefaultRounds if the setting has none.
+const (
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999_999_999
+	shaCryptDefaultRounds = 5000
+)
+
+// shaCrypt returns the SHA-crypt hash of password with the hash newHash and
+// the optional rounds and salt at the start of setting, which follows magic.
+func shaCrypt(password, magic, setting string, newHash func() hash.Hash, order [][]int) (string, error) {
+	rounds, customRounds := shaCryptDefaultRounds, false
+	if r, ok := strings.CutPrefix(setting, "rounds="); ok {
+		r, rest, _ := strings.Cut(r, "$")
+		n, err := strconv.ParseUint(r, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid rounds: %s", ErrMalformedHashtext, r)
+		}
+		rounds = int(min(max(n, shaCryptMinRounds), shaCryptMaxRounds))
+		customRounds = true
+		setting = rest
+	}
+	salt := []byte(cryptSalt(setting, 16))
+	pw := []byte(password)
+
+	alt := newHash()
+	alt.Write(pw)
+	alt.Write(salt)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	h := newHash()
+	h.Write(pw)
+	h.Write(salt)
+	for n := len(pw); n > 0; n -= len(altSum) {
+		h.Write(altSum[:min(n, len(altSum))])
+	}
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(altSum)
+		} else {
+			h.Write(pw)
+		}
+	}
+	sum := h.Sum(nil)
+
+	// repeatSum returns the hash of b repeated n times, repeated to the
+	// length of b.
+	repeatSum := func(b []byte, n int) []byte {
+		h := newHash()
+		for range n {
+			h.Write(b)
+		}
+		s := h.Sum(nil)
+		r := make([]byte, 0, len(b))
+		for len(r) < len(b) {
+			r = append(r, s[:min(len(s), len(b)-len(r))]...)
+		}
+		return r
+	}
+	p := repeatSum(pw, len(pw))
+	s := repeatSum(salt, 16+int(sum[0]))
+
+	for i := range rounds {
+		h := newHash()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(p)
+		}
+		sum = h.Sum(nil)
+	}
+
+	result := magic
+	if customRounds {
+		result += "rounds=" + strconv.Itoa(rounds) + "$"
+	}
+	return result + string(salt) + "$" + cryptEncode(sum, order), nil
+}
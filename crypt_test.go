@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Crypt(t *testing.T) {
+	type testcase struct {
+		password string
+		setting  string
+		want     string
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		got, err := crypt(tt.password, tt.setting)
+		is.NoErr(err)
+		is.Equal(tt.want, got)
+
+		// Hashing with the hash as the setting gives the same hash, which
+		// is how passwords are checked.
+		got, err = crypt(tt.password, tt.want)
+		is.NoErr(err)
+		is.Equal(tt.want, got)
+	}
+
+	// The hashes are from crypt(3) of glibc, e.g.
+	// perl -e 'print crypt("Hello world!", q($5$saltstring))'
+	// The SHA-crypt hashes include the test vectors of
+	// https://www.akkadia.org/drepper/SHA-crypt.txt
+	tests := map[string]testcase{
+		"MD5": {
+			password: "Hello world!",
+			setting:  "$1$saltstring",
+			want:     "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1",
+		},
+		"MD5 password": {
+			password: "password",
+			setting:  "$1$abcdefgh",
+			want:     "$1$abcdefgh$G//4keteveJp0qb8z2DxG/",
+		},
+		"MD5 empty salt": {
+			password: "password",
+			setting:  "$1$",
+			want:     "$1$$I2o9Z7NcvQAKp7wyCTlia0",
+		},
+		"MD5 empty password": {
+			password: "",
+			setting:  "$1$xy",
+			want:     "$1$xy$JSgu5Zv4igzK2ULm5nTM30",
+		},
+		"MD5 long password": {
+			password: "a long password that is longer than sixty-four bytes, so it is hashed twice",
+			setting:  "$1$12345678",
+			want:     "$1$12345678$DO/KN8IE8FWQoyWqX4MPj0",
+		},
+		"SHA-256": {
+			password: "Hello world!",
+			setting:  "$5$saltstring",
+			want:     "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		},
+		"SHA-256 rounds": {
+			password: "Hello world!",
+			setting:  "$5$rounds=10000$saltstringsaltstring",
+			want:     "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+		},
+		"SHA-256 long salt": {
+			password: "This is just a test",
+			setting:  "$5$toolongsaltstring",
+			want:     "$5$toolongsaltstrin$Un/5jzAHMgOGZ5.mWJpuVolil07guHPvOW8mGRcvxa5",
+		},
+		"SHA-256 short salt": {
+			password: "we have a short salt string but not a short password",
+			setting:  "$5$rounds=77777$short",
+			want:     "$5$rounds=77777$short$JiO1O3ZpDAxGJeaDIuqCoEFysAe1mZNJRs3pw0KQRd/",
+		},
+		"SHA-256 rounds too low": {
+			password: "the minimum number is still observed",
+			setting:  "$5$rounds=10$roundstoolow",
+			want:     "$5$rounds=1000$roundstoolow$yfvwcWrQ8l/K0DAWyuPMDNHpIVlTQebY9l/gL972bIC",
+		},
+		"SHA-256 long password": {
+			password: "a long password that is longer than sixty-four bytes, so it is hashed twice",
+			setting:  "$5$12345678",
+			want:     "$5$12345678$dy7ofXjLFMJoCsZe/WNwsLpGblF.HJ5QiPovIZmm/M5",
+		},
+		"SHA-512": {
+			password: "Hello world!",
+			setting:  "$6$saltstring",
+			want:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		"SHA-512 rounds": {
+			password: "Hello world!",
+			setting:  "$6$rounds=10000$saltstringsaltstring",
+			want:     "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		"SHA-512 default rounds given": {
+			password: "This is just a test",
+			setting:  "$6$rounds=5000$toolongsaltstring",
+			want:     "$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+		},
+		"SHA-512 long password": {
+			password: "a very much longer text to encrypt.  This one even stretches over morethan one line.",
+			setting:  "$6$rounds=1400$anotherlongsaltstring",
+			want:     "$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+		},
+		"SHA-512 many rounds": {
+			password: "a short string",
+			setting:  "$6$rounds=123456$asaltof16chars..",
+			want:     "$6$rounds=123456$asaltof16chars..$BtCwjqMJGx5hrJhZywWvt0RLE8uZ4oPwcelCjmw2kSYu.Ec6ycULevoBK25fs2xXgMNrCzIMVcgEJAstJeonj1",
+		},
+		"SHA-512 rounds too low": {
+			password: "the minimum number is still observed",
+			setting:  "$6$rounds=10$roundstoolow",
+			want:     "$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+		},
+		"SHA-512 empty password": {
+			password: "",
+			setting:  "$6$ab",
+			want:     "$6$ab$xnh5Qsr2NdbFw1PgdZie7nLON3gv.S.23iQDBqAzkdoXPtDnVSpludXkM5UWybQO3OI7hBj9wHg9Ow6sUWD60/",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_Crypt_Invalid(t *testing.T) {
+	is := is.New(t)
+	for _, setting := range []string{"$2y$05$bvIG6Nmid91Mu9RcmmWZfO", "ab01FAX.bQRSU", "", "$7$"} {
+		_, err := crypt("password", setting)
+		is.True(errors.Is(err, ErrUnsupportedCrypt)) // unsupported method accepted
+	}
+	_, err := crypt("password", "$6$rounds=many$salt")
+	is.True(errors.Is(err, ErrMalformedHashtext))
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"cmp"
+	"crypto/md5" //nolint:gosec // may be weak, but we use it
+	"crypto/pbkdf2"
 	"crypto/sha1" //nolint:gosec // may be weak, but we use it
 	"crypto/sha256"
 	"crypto/sha512"
@@ -11,9 +13,13 @@ import (
 	"fmt"
 	"hash"
 	"iter"
+	"log/slog"
+	"maps"
 	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/jimlambrt/gldap"
 )
 
 var (
@@ -22,6 +28,9 @@ var (
 	ErrMalformedBase64      = errors.New("hashtext base64 encoding malformed")
 	ErrHashtextTooShort     = errors.New("hashtext too short")
 	ErrMissingSalt          = errors.New("hashtext has missing salt")
+	ErrMalformedHashtext    = errors.New("hashtext malformed")
+	ErrOrphanEntry          = errors.New("orphan entry")
+	ErrDuplicateDN          = errors.New("duplicate DN")
 )
 
 // DB is an LDAP database, which is just a collection of entries and indicies
@@ -29,7 +38,55 @@ var (
 // entries DN.
 type DB struct {
 	DIT DITNode
-}
+	// ValidateEntries enables validation of entries against the schema
+	// (see [Schema.ValidateEntry]) when they are added to the DB.
+	ValidateEntries bool
+	// RDNAttrs is how entries that do not have the attribute values of
+	// their RDN are handled when they are added to the DB.
+	RDNAttrs RDNAttrsMode
+	// Orphans is how entries whose parent entry does not exist are handled
+	// when they are added to the DB.
+	Orphans OrphansMode
+	// Store, if set, durably stores the changes made by Add, Modify,
+	// Delete and ModifyDN, so they can be applied again with LoadStore.
+	Store Store
+}
+
+// RDNAttrsMode is how [DB.AddEntries] handles entries that do not have the
+// attribute values named by their RDN, such as an entry with the DN
+// "uid=alice,ou=people,dc=example,dc=com" that has no "uid: alice" attribute.
+// [RFC 4512, section 2.3.1] requires those values be present, but they are
+// not by default, as the entry is added as is.
+//
+// [RFC 4512, section 2.3.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-2.3.1
+type RDNAttrsMode int
+
+const (
+	// RDNAttrsIgnore adds entries without checking for their RDN values.
+	RDNAttrsIgnore RDNAttrsMode = iota
+	// RDNAttrsAdd adds any missing RDN values to the entries.
+	RDNAttrsAdd
+	// RDNAttrsReject rejects entries with missing RDN values.
+	RDNAttrsReject
+)
+
+// OrphansMode is how [DB.AddEntries] handles orphan entries: those whose
+// parent entry does not exist, such as "cn=x,ou=missing,dc=example,dc=com"
+// when "dc=example,dc=com" exists but "ou=missing,dc=example,dc=com" does
+// not. Entries with no existing ancestors at all are not orphans. They are
+// the top of a naming context.
+type OrphansMode int
+
+const (
+	// OrphansAllow adds orphan entries below their closest existing
+	// ancestor. If their parent is added later, they are moved below it.
+	OrphansAllow OrphansMode = iota
+	// OrphansReject rejects orphan entries.
+	OrphansReject
+	// OrphansCreate creates placeholder entries for the missing parents of
+	// orphan entries (see [newPlaceholderEntry]).
+	OrphansCreate
+)
 
 // Entry is a single ldap entry comprising a Distinguished Name (DN) and named
 // attributes that have multiple values. In an LDAP entry, attributes can
@@ -37,9 +94,77 @@ type DB struct {
 type Entry struct {
 	// DN is the distinguished name of the entry.
 	DN DN
-	// Attrs maps the lower-case attribute name to the attribute, so that
-	// attributes can be looked-up case-insensitively.
+	// Attrs maps the attribute key (see [Schema.attrKey]) to the attribute,
+	// so that attributes can be looked-up case-insensitively and by any of
+	// the names or the OID of the attribute type.
 	Attrs map[string]Attr
+	// Origin is the source the entry was loaded from.
+	Origin Origin
+}
+
+// Origin is the source of an [Entry]. The DB is built from layers of entries
+// from different sources. When entries from different origins have the same
+// DN, the one whose origin has the higher precedence (see
+// [Origin.Precedence]) is kept, and the other is ignored.
+//
+// The origin of an entry is returned in searches as the operational
+// attribute flapjakOrigin.
+type Origin int
+
+const (
+	// OriginStatic is the origin of entries from the static configuration,
+	// such as the jsonnet entries file. They cannot be modified through the
+	// DB write methods. It is the zero value, so entries are static unless
+	// given another origin.
+	OriginStatic Origin = iota
+	// OriginPlaceholder is the origin of the placeholder entries created
+	// for the missing parents of orphan entries (see [OrphansCreate]).
+	OriginPlaceholder
+	// OriginFiles is the origin of entries loaded from a directory of
+	// JSON files alongside the static entries.
+	OriginFiles
+	// OriginLDAP is the origin of entries added or modified through the DB
+	// write methods, such as by LDAP clients, and loaded from the
+	// [Store] of the DB.
+	OriginLDAP
+)
+
+// originAttr is the name of the operational attribute holding the origin of
+// an entry.
+const originAttr = "flapjakOrigin"
+
+// String returns the name of the origin, as used for the value of the
+// flapjakOrigin attribute.
+func (o Origin) String() string {
+	switch o {
+	case OriginStatic:
+		return "static"
+	case OriginPlaceholder:
+		return "placeholder"
+	case OriginFiles:
+		return "files"
+	case OriginLDAP:
+		return "ldap"
+	default:
+		return "unknown"
+	}
+}
+
+// Precedence returns the precedence of entries of the origin. Static entries
+// have the highest precedence so that they are authoritative, followed by
+// entries written over LDAP, so that changes to entries from files persist,
+// then entries from files, and placeholders, which any real entry replaces.
+func (o Origin) Precedence() int {
+	switch o {
+	case OriginPlaceholder:
+		return 0
+	case OriginFiles:
+		return 1
+	case OriginLDAP:
+		return 2
+	default:
+		return 3
+	}
 }
 
 // Attr is an attribute of an Entry.
@@ -54,30 +179,83 @@ type Attr struct {
 
 // AddAttr adds attr to e. It can be retrieved with GetAttr. The name
 // of the attribute is case-insensitive for lookups. If the attribute
-// already exists with the same case-insensitive name, the existing
-// attribute will be replaced.
+// already exists with the same case-insensitive name, or another name or OID
+// of the same attribute type, the existing attribute will be replaced.
 func (e *Entry) AddAttr(attr Attr) {
-	e.Attrs[strings.ToLower(attr.Name)] = attr
+	e.Attrs[schema.attrKey(attr.Name)] = attr
 }
 
 // GetAttr returns the attribute values for the given attribute name and true
 // if the attribute exists, or an empty slice and false if it does not.
-// The attribute name is case-insensitive.
+// The attribute name is case-insensitive and may be any of the names or the
+// OID of the attribute type.
 func (e *Entry) GetAttr(attr string) (Attr, bool) {
-	// TODO(camh): Support lookup by OID
-	v, ok := e.Attrs[strings.ToLower(attr)]
+	v, ok := e.Attrs[schema.attrKey(attr)]
 	return v, ok
 }
 
+// clone returns a copy of e that can be modified without modifying e.
+func (e *Entry) clone() *Entry {
+	c := &Entry{DN: slices.Clone(e.DN), Attrs: make(map[string]Attr, len(e.Attrs)), Origin: e.Origin}
+	for k, a := range e.Attrs {
+		c.Attrs[k] = Attr{Name: a.Name, Vals: slices.Clone(a.Vals)}
+	}
+	return c
+}
+
+// withOrigin returns a copy of e with the flapjakOrigin operational attribute
+// naming its origin added. The attributes are shared with e so must not be
+// modified.
+func (e *Entry) withOrigin() *Entry {
+	c := &Entry{DN: e.DN, Attrs: maps.Clone(e.Attrs), Origin: e.Origin}
+	c.AddAttr(Attr{Name: originAttr, Vals: []string{e.Origin.String()}})
+	return c
+}
+
+// SelectAttrs returns the attributes of e selected by the attribute names
+// requested in a search, as described in [RFC 4511, section 4.5.1.8]. If no
+// names are requested or "*" is, all user attributes are selected. If "+" is
+// requested, all operational attributes (see [AttributeType.IsOperational])
+// are selected. Otherwise attributes are only selected if they are requested
+// by name. The special name "1.1" selects no attributes.
+//
+// [RFC 4511, section 4.5.1.8]: https://datatracker.ietf.org/doc/html/rfc4511#section-4.5.1.8
+func (e *Entry) SelectAttrs(names []string) []Attr {
+	allUser := len(names) == 0 || slices.Contains(names, "*")
+	allOperational := slices.Contains(names, "+")
+	requested := map[string]bool{}
+	for _, name := range names {
+		requested[schema.attrKey(name)] = true
+	}
+
+	var attrs []Attr
+	for _, key := range slices.Sorted(maps.Keys(e.Attrs)) {
+		a := e.Attrs[key]
+		at := schema.AttributeType(a.Name)
+		operational := at != nil && at.IsOperational()
+		if requested[key] || (operational && allOperational) || (!operational && allUser) {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
 // Authenticate checks that the LDAP Entry is valid for authentication and that
 // the entry has a password that matches the given password. If so nil is
 // returned. Otherwise an error is returned.
 //
 // The form of hashed password in an entry is described by "[RFC 2307, 5.3]
-// Interpreting user and group entries" with the supported schemes being SSHA
-// (salted SHA-1), SSHA256 (salted SHA-256) and SSHA512 (salted SHA-512). This
-// is how [OpenLDAP passwords] are done, so this does it the same. e.g.
-// "{SSHA}<base64-encoded-hash+salt>".
+// Interpreting user and group entries". This is how [OpenLDAP passwords] are
+// done, so this does it the same. e.g. "{SSHA}<base64-encoded-hash+salt>".
+// The scheme is case-insensitive. The supported schemes are:
+//
+//   - SSHA, SSHA256, SSHA512 and SMD5: salted SHA-1, SHA-256, SHA-512 and MD5
+//   - SHA and MD5: unsalted SHA-1 and MD5
+//   - CRYPT: MD5-crypt ($1$), SHA-256-crypt ($5$) and SHA-512-crypt ($6$)
+//   - PBKDF2, PBKDF2-SHA1, PBKDF2-SHA256 and PBKDF2-SHA512: PBKDF2 with
+//     HMAC-SHA-1 (for the first two), HMAC-SHA-256 and HMAC-SHA-512, in the
+//     form of the OpenLDAP pw-pbkdf2 module and passlib, e.g.
+//     "{PBKDF2-SHA512}<iterations>$<salt>$<hash>"
 //
 // [RFC 2307, 5.3]: https://datatracker.ietf.org/doc/html/rfc2307#section-5.3
 // [OpenLDAP passwords]: https://www.openldap.org/faq/data/cache/347.html
@@ -87,21 +265,31 @@ func (e *Entry) Authenticate(password string) error {
 	}
 
 	// hashSchemes is a list of supported password hashing schemes
-	// with their functions for creating a hash.Hash for that scheme.
-	hashSchemes := map[string]func() hash.Hash{
-		"{SSHA}":    sha1.New,
-		"{SSHA256}": sha256.New,
-		"{SSHA512}": sha512.New,
+	// with their functions for checking a password against the hashtext
+	// of that scheme.
+	hashSchemes := map[string]func(password, hashtext string) (bool, error){
+		"{SSHA}":          saltedHash(sha1.New),
+		"{SSHA256}":       saltedHash(sha256.New),
+		"{SSHA512}":       saltedHash(sha512.New),
+		"{SMD5}":          saltedHash(md5.New),
+		"{SHA}":           unsaltedHash(sha1.New),
+		"{MD5}":           unsaltedHash(md5.New),
+		"{CRYPT}":         pwCheckCrypt,
+		"{PBKDF2}":        pbkdf2Hash(sha1.New),
+		"{PBKDF2-SHA1}":   pbkdf2Hash(sha1.New),
+		"{PBKDF2-SHA256}": pbkdf2Hash(sha256.New),
+		"{PBKDF2-SHA512}": pbkdf2Hash(sha512.New),
 	}
 
 	var firstErr error
 	hashedPasswords, _ := e.GetAttr("userPassword")
 	for _, hashedPassword := range hashedPasswords.Vals {
 		scheme, hashtext, ok := splitScheme(hashedPassword)
-		if !ok || hashSchemes[scheme] == nil {
+		check := hashSchemes[strings.ToUpper(scheme)]
+		if !ok || check == nil {
 			continue
 		}
-		ok, err := pwCheckSaltedHash(password, hashtext, hashSchemes[scheme])
+		ok, err := check(password, hashtext)
 		if ok {
 			return nil
 		}
@@ -135,6 +323,30 @@ func splitScheme(hashedPassword string) (string, string, bool) {
 	return hashedPassword[:idx+1], hashedPassword[idx+1:], true
 }
 
+// saltedHash returns a function that checks a password against the hashtext
+// of a salted hash with pwCheckSaltedHash.
+func saltedHash(newHash func() hash.Hash) func(password, hashtext string) (bool, error) {
+	return func(password, hashtext string) (bool, error) {
+		return pwCheckSaltedHash(password, hashtext, newHash)
+	}
+}
+
+// unsaltedHash returns a function that checks a password against the
+// hashtext of an unsalted hash with pwCheckUnsaltedHash.
+func unsaltedHash(newHash func() hash.Hash) func(password, hashtext string) (bool, error) {
+	return func(password, hashtext string) (bool, error) {
+		return pwCheckUnsaltedHash(password, hashtext, newHash)
+	}
+}
+
+// pbkdf2Hash returns a function that checks a password against the hashtext
+// of a PBKDF2 hash with pwCheckPBKDF2.
+func pbkdf2Hash(newHash func() hash.Hash) func(password, hashtext string) (bool, error) {
+	return func(password, hashtext string) (bool, error) {
+		return pwCheckPBKDF2(password, hashtext, newHash)
+	}
+}
+
 func pwCheckSaltedHash(password string, hashtext string, newHash func() hash.Hash) (bool, error) {
 	h := newHash()
 	hps, err := base64.StdEncoding.DecodeString(hashtext)
@@ -157,14 +369,182 @@ func pwCheckSaltedHash(password string, hashtext string, newHash func() hash.Has
 	return bytes.Equal(h.Sum(nil), expected), nil
 }
 
+func pwCheckUnsaltedHash(password string, hashtext string, newHash func() hash.Hash) (bool, error) {
+	h := newHash()
+	expected, err := base64.StdEncoding.DecodeString(hashtext)
+	if err != nil {
+		return false, ErrMalformedBase64
+	}
+	if len(expected) != h.Size() {
+		return false, ErrMalformedHashtext
+	}
+
+	h.Write([]byte(password))
+
+	return bytes.Equal(h.Sum(nil), expected), nil
+}
+
+// pwCheckCrypt checks password against hashtext hashed with [crypt].
+func pwCheckCrypt(password string, hashtext string) (bool, error) {
+	hashed, err := crypt(password, hashtext)
+	if err != nil {
+		return false, err
+	}
+	return hashed == hashtext, nil
+}
+
+// ab64Encoding is the "adapted base64" encoding of PBKDF2 hashtext, which is
+// the standard encoding with "." in place of "+" and without padding.
+var ab64Encoding = base64.NewEncoding(strings.ReplaceAll(
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/", "+", ".",
+)).WithPadding(base64.NoPadding)
+
+// pwCheckPBKDF2 checks password against hashtext of the form
+// "<iterations>$<salt>$<hash>" with the salt and hash in ab64Encoding, hashed
+// with PBKDF2 with HMAC and newHash.
+func pwCheckPBKDF2(password string, hashtext string, newHash func() hash.Hash) (bool, error) {
+	parts := strings.Split(hashtext, "$")
+	if len(parts) != 3 {
+		return false, ErrMalformedHashtext
+	}
+	iter, err := strconv.Atoi(parts[0])
+	if err != nil || iter < 1 {
+		return false, ErrMalformedHashtext
+	}
+	salt, err := ab64Encoding.DecodeString(parts[1])
+	if err != nil {
+		return false, ErrMalformedBase64
+	}
+	expected, err := ab64Encoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrMalformedBase64
+	}
+	if len(expected) == 0 {
+		return false, ErrHashtextTooShort
+	}
+
+	key, err := pbkdf2.Key(newHash, password, salt, iter, len(expected))
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(key, expected), nil
+}
+
 // HasValue returns true if val is one of the values of the attribute. The
-// value is compared case-insensitively, regardless of what an LDAP schema
-// may say for that attribute.
+// values are compared with the equality matching rule of the attribute (see
+// [Schema.EqualityRule]), so are case-insensitive unless the schema says
+// otherwise.
 func (a Attr) HasValue(val string) bool {
-	// TODO(camh): Handle case-sensitive values
-	lv := strings.ToLower(val)
+	return a.indexValue(val) != -1
+}
+
+// indexValue returns the index of the first value of a that matches val with
+// the equality matching rule of the attribute, or -1 if none does.
+func (a Attr) indexValue(val string) int {
+	mr := schema.EqualityRule(a.Name)
+	return slices.IndexFunc(a.Vals, func(v string) bool {
+		c, ok := mr.Compare(v, val)
+		return ok && c == 0
+	})
+}
+
+// HasSubstring returns true if any of the values of the attribute starts with
+// initial, contains each element of anys in order and ends with final, without
+// any of those parts overlapping. The values are matched with the substrings
+// matching rule of the attribute (see [Schema.SubstringsRule]).
+func (a Attr) HasSubstring(initial string, anys []string, final string) bool {
+	mr := schema.SubstringsRule(a.Name)
+	for _, v := range a.Vals {
+		if mr.MatchSubstrings(v, initial, anys, final) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasApproxValue returns true if any of the values of the attribute
+// approximately matches val. Values are approximately matched by splitting
+// them into whitespace-separated words, ignoring case, and comparing the
+// [Soundex] code of each word. The values match if they have the same number
+// of words and each word has the same code as the word in the same position in
+// the other value. Words containing anything other than the letters a to z
+// have no Soundex code and must match exactly (ignoring case).
+//
+// The approximation is deterministic and does not depend on the attribute.
+// "Jon Smyth" approximately matches "John Smith" but not "John".
+//
+// [Soundex]: https://en.wikipedia.org/wiki/Soundex
+func (a Attr) HasApproxValue(val string) bool {
+	key := approxKey(val)
+	for _, v := range a.Vals {
+		if slices.Equal(approxKey(v), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func approxKey(s string) []string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		words[i] = soundex(w)
+	}
+	return words
+}
+
+// soundex returns the American Soundex code for a lower-case word. If the word
+// contains any characters other than a-z, the word is returned unchanged.
+func soundex(word string) string {
+	// soundexCodes are the digits for each letter a-z. Vowels (and y) are
+	// zero and separate consonants with the same code. h and w are also
+	// zero but do not separate consonants.
+	const soundexCodes = "01230120022455012623010202"
+
+	for _, r := range word {
+		if r < 'a' || r > 'z' {
+			return word
+		}
+	}
+
+	code := []byte{word[0]}
+	last := soundexCodes[word[0]-'a']
+	for i := 1; i < len(word) && len(code) < 4; i++ {
+		c := word[i]
+		digit := soundexCodes[c-'a']
+		switch {
+		case c == 'h' || c == 'w':
+			continue
+		case digit != '0' && digit != last:
+			code = append(code, digit)
+		}
+		last = digit
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// CompareValues compares the attribute values v1 and v2, returning -1 if v1
+// orders before v2, 1 if it orders after it and 0 if they are equal. The
+// second return value is false if the values cannot be ordered.
+//
+// The values are compared with the ordering matching rule of the attribute
+// (see [Schema.OrderingRule]). Values of integer attributes such as uidNumber
+// are compared numerically, and cannot be ordered if either value is not an
+// integer. Values of most other attributes are compared lexically and
+// case-insensitively.
+func (a Attr) CompareValues(v1, v2 string) (int, bool) {
+	return schema.OrderingRule(a.Name).Compare(v1, v2)
+}
+
+// hasOrderedValue returns true if any value of the attribute can be ordered
+// with val (see [Attr.CompareValues]) and cmpOK returns true for the result of
+// that comparison.
+func (a Attr) hasOrderedValue(val string, cmpOK func(int) bool) bool {
 	for _, v := range a.Vals {
-		if strings.ToLower(v) == lv {
+		if c, ok := a.CompareValues(v, val); ok && cmpOK(c) {
 			return true
 		}
 	}
@@ -184,46 +564,97 @@ func (a Attr) IsSensitive() bool {
 // index of entries indexed by DN. Often an LDAP search is performed relative
 // to a BaseDN. The DIT allows a search to be constrained to a sub-tree of the
 // total DIT.
+//
+// Entries are placed in the DIT by the normalised form of their DN (see
+// [DN.Normalize]), so DNs that differ only in the spelling of attribute names
+// or in ways their matching rules ignore refer to the same node. The entry
+// keeps the DN as it was given.
 type DITNode struct {
 	Entry    *Entry
 	children []*DITNode
+	// norm is the normalised DN of Entry as the string form of each RDN,
+	// in the same order as the DN.
+	norm []string
 }
 
-// RDN (Relative Distinguished Name) is a single element of a DN (Distinguished
-// Name) and is a name/value pair specifying an attribute name and value. Multi-
-// valued RDNs are not supported. When compared, RDN names are case-insensitive.
-// Values are case-sensitive. In string form, RDNs are of the form "name=value"
-// with possible whitespace around the "=", which is stripped when parsed.
-type RDN struct{ Name, Value string }
-
-// DN is a parsed DN string into a slice of RDNs, in the reverse order they
-// are in the string. Each RDN is separated by a comma and may contain
-// whitespace around the comma, which is stripped.
-type DN []RDN
+func newDITNode(e *Entry) *DITNode {
+	return &DITNode{Entry: e, norm: e.DN.Normalize().rdnStrings()}
+}
 
-// NewDB returns a new DB with a single root entry for the DIT for the server's
-// Directory Server Entry ([DSE]) (or is it DSA-Specific Entry?).
+// NewDB returns a new DB with a root entry for the DIT for the server's
+// Directory Server Entry ([DSE]) (or is it DSA-Specific Entry?) and the
+// subschema subentry (see [Schema.SubschemaEntry]) below it.
 //
-// For now, we do not populate it with any attributes.
+// The root DSE stored in the DIT only has the subschemaSubentry attribute
+// naming the subschema subentry. The attributes describing the naming
+// contexts and the capabilities of the server are added by the server when
+// the root DSE is searched, as they change with the contents of the DIT.
 //
 // [DSE}: https://ldap.com/dit-and-the-ldap-root-dse/
 func NewDB() *DB {
-	dse := DITNode{
-		Entry: &Entry{
-			DN: DN{},
-			Attrs: map[string]Attr{
-				"objectClass": {"objectClass", []string{"top"}},
-			},
+	subschema := schema.SubschemaEntry(DN{{{Name: "cn", Value: "Subschema"}}})
+	dse := newDITNode(&Entry{
+		DN: DN{},
+		Attrs: map[string]Attr{
+			"objectclass":       {"objectClass", []string{"top"}},
+			"subschemasubentry": {"subschemaSubentry", []string{subschema.DN.String()}},
 		},
+	})
+	dse.children = []*DITNode{newDITNode(subschema)}
+	return &DB{DIT: *dse}
+}
+
+// NamingContexts returns the DNs of the naming contexts held by the database:
+// the entries at the top of the DIT, directly below the root DSE. The
+// subschema subentry is not a naming context and is excluded.
+func (db *DB) NamingContexts() []DN {
+	var dns []DN
+	for child := range db.DIT.Children() {
+		if !db.isSubschema(child.Entry.DN) {
+			dns = append(dns, child.Entry.DN)
+		}
 	}
-	return &DB{DIT: dse}
+	return dns
+}
+
+// isSubschema returns whether dn is the DN of the subschema subentry named
+// by the root DSE.
+func (db *DB) isSubschema(dn DN) bool {
+	subschema, _ := db.DIT.Entry.GetAttr("subschemaSubentry")
+	return slices.ContainsFunc(subschema.Vals, func(v string) bool {
+		ssdn, err := NewDN(v)
+		return err == nil && ssdn.Equal(dn)
+	})
 }
 
 // AddEntries adds the given entries to the database. If the database has any
-// entries with the same DN as any of the ones being added, an error is
-// returned. Any entries prior to the one with the duplicate DN will be added
-// to the database.
+// entries with the same DN as any of the ones being added, the entry whose
+// origin has the higher precedence is kept (see [Origin]). If they have the
+// same precedence, an error wrapping [ErrDuplicateDN] is returned. Any
+// entries prior to the one with the duplicate DN will be added to the
+// database.
+//
+// The attribute values of the RDN of each entry are first added or checked
+// as set by RDNAttrs. If ValidateEntries is set, all the entries are then
+// validated against the schema. Orphan entries are then rejected or have
+// parents created for them as set by Orphans. The parent of an entry may be
+// anywhere in entries, not only before it. If any entry is missing RDN values
+// that are not added, is invalid or is a rejected orphan, none are added and
+// an error joining the errors for every violation in every entry is returned.
 func (db *DB) AddEntries(entries []*Entry) error {
+	var errs []error
+	for _, e := range entries {
+		errs = append(errs, db.addRDNAttrs(e)...)
+		if db.ValidateEntries {
+			errs = append(errs, schema.ValidateEntry(e)...)
+		}
+	}
+	placeholders, orphanErrs := db.findOrphans(entries)
+	errs = append(errs, orphanErrs...)
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	entries = append(slices.Clip(entries), placeholders...)
 	for _, e := range entries {
 		if err := db.DIT.insert(e); err != nil {
 			return err
@@ -232,25 +663,161 @@ func (db *DB) AddEntries(entries []*Entry) error {
 	return nil
 }
 
+// addRDNAttrs adds the attribute values of the RDN of e that e does not have
+// to it if db.RDNAttrs is RDNAttrsAdd. If it is RDNAttrsReject, an error
+// wrapping [ErrSchemaViolation] is returned for each missing value instead.
+func (db *DB) addRDNAttrs(e *Entry) []error {
+	if db.RDNAttrs == RDNAttrsIgnore || e.DN.IsEmpty() {
+		return nil
+	}
+	var errs []error
+	for _, ava := range e.DN[len(e.DN)-1] {
+		attr, ok := e.GetAttr(ava.Name)
+		if ok && attr.HasValue(ava.Value) {
+			continue
+		}
+		if db.RDNAttrs == RDNAttrsReject {
+			errs = append(errs, fmt.Errorf("%w: %s: missing RDN value %s", ErrSchemaViolation, e.DN, ava))
+			continue
+		}
+		if !ok {
+			attr.Name = ava.Name
+		}
+		attr.Vals = append(slices.Clip(attr.Vals), ava.Value)
+		e.AddAttr(attr)
+	}
+	return errs
+}
+
+// findOrphans finds the orphan entries in entries, given the entries already
+// in db. If db.Orphans is OrphansReject, an error wrapping [ErrOrphanEntry] is
+// returned for each. If it is OrphansCreate, placeholder entries for all the
+// missing parents are returned.
+func (db *DB) findOrphans(entries []*Entry) ([]*Entry, []error) {
+	if db.Orphans == OrphansAllow {
+		return nil, nil
+	}
+	added := map[string]bool{}
+	for _, e := range entries {
+		added[e.DN.Normalize().String()] = true
+	}
+	exists := func(dn DN) bool {
+		return added[dn.Normalize().String()] || db.DIT.Find(dn) != nil
+	}
+
+	var placeholders []*Entry
+	var errs []error
+	for _, e := range entries {
+		if len(e.DN) < 2 || exists(e.DN[:len(e.DN)-1]) {
+			continue
+		}
+		// Find the closest existing ancestor. If there is none, the
+		// entry is the top of a naming context and not an orphan.
+		n := len(e.DN) - 2
+		for n > 0 && !exists(e.DN[:n]) {
+			n--
+		}
+		if n == 0 {
+			continue
+		}
+		if db.Orphans == OrphansReject {
+			errs = append(errs, fmt.Errorf("%w: %s: parent %s does not exist", ErrOrphanEntry, e.DN, e.DN[:len(e.DN)-1]))
+			continue
+		}
+		for n++; n < len(e.DN); n++ {
+			p := newPlaceholderEntry(e.DN[:n])
+			placeholders = append(placeholders, p)
+			added[p.DN.Normalize().String()] = true
+		}
+	}
+	return placeholders, errs
+}
+
+// Compare compares value with the values of the attribute attr of the entry
+// with the given DN, as described for the LDAP Compare operation in
+// [RFC 4511, section 4.10]. It returns true if the entry has the value,
+// matching it as an equality filter does (see [Equality]), and false if not.
+// If there is no entry with the DN, an [LDAPError] of noSuchObject is
+// returned. If the entry does not have the attribute, an [LDAPError] of
+// noSuchAttribute is returned.
+//
+// [RFC 4511, section 4.10]: https://datatracker.ietf.org/doc/html/rfc4511#section-4.10
+func (db *DB) Compare(dn DN, attr, value string) (bool, error) {
+	node := db.DIT.Find(dn)
+	if node == nil {
+		return false, LDAPError(gldap.ResultNoSuchObject)
+	}
+	e := node.Entry.withOrigin()
+	if _, ok := e.GetAttr(attr); !ok {
+		return false, LDAPError(gldap.ResultNoSuchAttribute)
+	}
+	f := &Equality{Attr: attr, Value: value}
+	return f.Match(e), nil
+}
+
+// placeholderClasses maps the attribute keys of common naming attributes to
+// the structural object class of placeholder entries named by them.
+var placeholderClasses = map[string]string{
+	"c":  "country",
+	"dc": "domain",
+	"l":  "locality",
+	"o":  "organization",
+	"ou": "organizationalUnit",
+}
+
+// newPlaceholderEntry returns an entry to stand in for the missing parent
+// with the given DN of an orphan entry. It has the attribute values of its
+// RDN, and the object classes extensibleObject and, if it is named by a
+// common naming attribute such as ou, the structural object class for the
+// attribute, such as organizationalUnit. Placeholder entries are not
+// validated against the schema.
+func newPlaceholderEntry(dn DN) *Entry {
+	e := &Entry{DN: dn, Attrs: map[string]Attr{}, Origin: OriginPlaceholder}
+	classes := []string{"top"}
+	for _, ava := range dn[len(dn)-1] {
+		e.AddAttr(Attr{Name: ava.Name, Vals: []string{ava.Value}})
+		if oc, ok := placeholderClasses[schema.attrKey(ava.Name)]; ok && len(classes) == 1 {
+			classes = append(classes, oc)
+		}
+	}
+	e.AddAttr(Attr{Name: "objectClass", Vals: append(classes, "extensibleObject")})
+	return e
+}
+
 func (dit *DITNode) insert(entry *Entry) error {
-	// Duplicate DN
-	if entry.DN.Equal(dit.Entry.DN) {
-		return fmt.Errorf("duplicate DN: %s", entry.DN)
+	return dit.insertNode(newDITNode(entry))
+}
+
+func (dit *DITNode) insertNode(newnode *DITNode) error {
+	// Duplicate DN. Keep the entry from the origin with higher precedence.
+	if slices.Equal(newnode.norm, dit.norm) {
+		newOrigin, oldOrigin := newnode.Entry.Origin, dit.Entry.Origin
+		switch {
+		case newOrigin.Precedence() == oldOrigin.Precedence():
+			return fmt.Errorf("%w: %s", ErrDuplicateDN, newnode.Entry.DN)
+		case newOrigin.Precedence() > oldOrigin.Precedence():
+			slog.Info("entry replaces entry of lower precedence", "dn", newnode.Entry.DN.String(),
+				"origin", newOrigin.String(), "replaced", oldOrigin.String())
+			dit.Entry = newnode.Entry
+		default:
+			slog.Info("entry ignored for entry of higher precedence", "dn", newnode.Entry.DN.String(),
+				"origin", newOrigin.String(), "kept", oldOrigin.String())
+		}
+		return nil
 	}
 
 	// We are below a child of the current node
 	for _, child := range dit.children {
-		if child.Entry.DN.IsAncestor(entry.DN) {
-			return child.insert(entry)
+		if child.isAncestorOf(newnode.norm) {
+			return child.insertNode(newnode)
 		}
 	}
 
 	// We are a child of the current node and maybe take over some of
 	// its children we are their ancestor.
-	newnode := &DITNode{Entry: entry}
 	siblings := []*DITNode{}
 	for _, child := range dit.children {
-		if entry.DN.IsAncestor(child.Entry.DN) {
+		if newnode.isAncestorOf(child.norm) {
 			newnode.children = append(newnode.children, child)
 		} else {
 			siblings = append(siblings, child)
@@ -262,22 +829,33 @@ func (dit *DITNode) insert(entry *Entry) error {
 }
 
 // Find searches the DIT for an entry with the given DN and returns it. If no
-// entry matches, nil is returned.
+// entry matches, nil is returned. The DN is normalised (see [DN.Normalize])
+// before searching, so it need not be spelled the same as the entry's DN.
 func (dit *DITNode) Find(dn DN) *DITNode {
-	if dit.Entry.DN.Equal(dn) {
+	return dit.find(dn.Normalize().rdnStrings())
+}
+
+func (dit *DITNode) find(norm []string) *DITNode {
+	if slices.Equal(dit.norm, norm) {
 		return dit
 	}
-	if !dit.Entry.DN.IsAncestor(dn) {
+	if !dit.isAncestorOf(norm) {
 		return nil
 	}
 	for _, child := range dit.children {
-		if child.Entry.DN.IsAncestor(dn) {
-			return child.Find(dn)
+		if child.isAncestorOf(norm) {
+			return child.find(norm)
 		}
 	}
 	return nil
 }
 
+// isAncestorOf returns whether the node is an ancestor of, or the same as,
+// the entry with the normalised DN norm.
+func (dit *DITNode) isAncestorOf(norm []string) bool {
+	return len(dit.norm) <= len(norm) && slices.Equal(dit.norm, norm[:len(dit.norm)])
+}
+
 func (dit *DITNode) String() string {
 	return dit.str(DN{}, 0)
 }
@@ -331,132 +909,6 @@ func (dit *DITNode) walk(yield func(*DITNode) bool) bool {
 	return true
 }
 
-// ParseRDN parse a RDN string value, returning an RDN or an error if it could
-// not be parsed. The format must be "name=value" with optional whitespace
-// around the "=". name is mandatory. value may be omitted.
-func ParseRDN(rdn string) (RDN, error) {
-	name, val, ok := strings.Cut(rdn, "=")
-	if !ok {
-		return RDN{}, fmt.Errorf("invalid rdn: %v", rdn)
-	}
-	result := RDN{Name: strings.TrimSpace(name), Value: strings.TrimSpace(val)}
-	if result.Name == "" {
-		return RDN{}, fmt.Errorf("no attribute name in rdn: %v", rdn)
-	}
-	return result, nil
-}
-
-// String returns rdn in string form. It implements the [fmt.Stringer]
-// interface.
-func (rdn RDN) String() string {
-	return rdn.Name + "=" + rdn.Value
-}
-
-// Equal compares rdn to rhs returning true if they are equal and false if not.
-// The attribute name of the RDNs are compared case-insensitively. The values
-// are compared case-sensitively if the names compare equal.
-func (rdn RDN) Equal(rhs RDN) bool {
-	if !strings.EqualFold(rdn.Name, rhs.Name) {
-		return false
-	}
-	// TODO(camh): Handle case-insensitive attribute values where appropriate
-	return rdn.Value == rhs.Value
-}
-
-// Compare compares rdn to rhs returning -1 if rdn orders before rhs, 1 if it
-// orders after it and 0 if the are equal. The attribute names are compared
-// case-insensitively. The values are compared case-sensitively if the names
-// compare equal. Compare can be used as a comparison function for
-// [slices.CompareFunc] and similar functions.
-func (rdn RDN) Compare(rhs RDN) int {
-	lname, rname := strings.ToLower(rdn.Name), strings.ToLower(rhs.Name)
-	switch {
-	case lname < rname:
-		return -1
-	case lname > rname:
-		return +1
-	default:
-		// TODO(camh): Handle case-insensitive attribute values where appropriate
-		return strings.Compare(rdn.Value, rhs.Value)
-	}
-}
-
-// NewDN constructs a DN from the given string representing a DN. If any of the
-// RDN components in the DN string are invalid (see [ParseRDN]), an error is
-// returned.
-func NewDN(dnstr string) (DN, error) {
-	dnstr = strings.TrimSpace(dnstr)
-	if dnstr == "" {
-		// The empty DN string is the root DN.
-		return DN{}, nil
-	}
-
-	elems := strings.Split(dnstr, ",")
-	result := make(DN, 0, len(elems))
-	for i := len(elems) - 1; i >= 0; i-- {
-		rdn, err := ParseRDN(elems[i])
-		if err != nil {
-			return nil, err
-		}
-		result = append(result, rdn)
-		// TODO(camh): backslash de-escaping
-	}
-	return result, nil
-}
-
-// String formats dn into a string representation of the DN and returns it.
-func (dn DN) String() string {
-	// TODO(camh): escape chars (RFC 4514)
-	elems := make([]string, 0, len(dn))
-	for i := len(dn) - 1; i >= 0; i-- {
-		elems = append(elems, dn[i].String())
-	}
-	return strings.Join(elems, ",")
-}
-
-// IsAncestor returns whether dn is an ancestor of sub. A dn is an ancestor
-// of sub if dn matches the leading elements of sub. A DN is an ancestor of itself.
-func (dn DN) IsAncestor(sub DN) bool {
-	if len(dn) > len(sub) {
-		return false
-	}
-	for i := range dn {
-		if !dn[i].Equal(sub[i]) {
-			return false
-		}
-	}
-	return true
-}
-
-// Equal returns true if dn is equal to rhs.
-func (dn DN) Equal(rhs DN) bool {
-	return slices.EqualFunc(dn, rhs, RDN.Equal)
-}
-
-// CommonAncestor returns a DN that has the common ancestor of dn and other.
-// If there is no common ancestor, the root DN is returned.
-func (dn DN) CommonAncestor(other DN) DN {
-	common := make(DN, 0, min(len(dn), len(other)))
-	for i := range cap(common) {
-		if !dn[i].Equal(other[i]) {
-			break
-		}
-		common = append(common, dn[i])
-	}
-	return common
-}
-
-// Tail returns the parts of dn after the common ancestor of dn and head.
-func (dn DN) Tail(head DN) DN {
-	c := dn.CommonAncestor(head)
-	return dn[len(c):]
-}
-
-// IsEmpty returns true if dn is the root DN. The root DN has no components.
-func (dn DN) IsEmpty() bool {
-	return len(dn) == 0
-}
-
 // NewEntryFromMap returns an Entry from the elements in attrs. It is intended
 // to build an entry from a JSON or similar representation - a string-encoded
 // map of attribute names to slice of values.
@@ -518,14 +970,25 @@ func NewEntryFromMap(attrs map[string]any) (*Entry, error) {
 		e.AddAttr(attr)
 	}
 
-	// Validate that the entry contains at least an objectClass
-	// and a dn attribute.
+	if err := e.checkRequired(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// checkRequired returns an error if e does not have a DN and an objectClass,
+// or has an attribute named "dn", as [NewEntryFromMap] requires of the
+// entries it returns. Entries written to a [Store] are read back with
+// NewEntryFromMap, so they are checked with this before being written.
+func (e *Entry) checkRequired() error {
 	if e.DN.IsEmpty() {
-		return nil, errors.New("missing DN")
+		return errors.New("missing DN")
 	}
 	if _, ok := e.GetAttr("objectClass"); !ok {
-		return nil, fmt.Errorf("missing objectClass for %s", e.DN)
+		return fmt.Errorf("missing objectClass for %s", e.DN)
 	}
-
-	return e, nil
+	if _, ok := e.GetAttr("dn"); ok {
+		return fmt.Errorf("invalid attribute type dn for %s", e.DN)
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/md5"  //nolint:gosec // may be weak, but we use it
 	"crypto/sha1" //nolint:gosec // may be weak, but we use it
 	"crypto/sha256"
 	"crypto/sha512"
@@ -11,65 +12,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/jimlambrt/gldap"
 	"github.com/matryer/is"
 )
 
-func MustDN(t *testing.T, dnstr string) DN {
-	is := is.New(t)
-	is.Helper()
-	dn, err := NewDN(dnstr)
-	is.NoErr(err)
-	return dn
-}
-
-func Test_RDN(t *testing.T) {
-	is := is.New(t)
-
-	rdn1 := RDN{Name: "dc", Value: "example"}
-	rdn2 := RDN{Name: "DC", Value: "example"}
-	rdn3 := RDN{Name: "Dc", Value: "example2"}
-	rdn4 := RDN{Name: "ou", Value: "core"}
-
-	is.True(rdn1.Equal(rdn1))
-	is.True(rdn2.Equal(rdn2))
-	is.True(!rdn1.Equal(rdn3))
-	is.True(!rdn1.Equal(rdn4))
-
-	is.Equal(-1, rdn1.Compare(rdn3))
-	is.Equal(1, rdn3.Compare(rdn2))
-	is.Equal(0, rdn1.Compare(rdn1))
-	is.Equal(0, rdn1.Compare(rdn2))
-	is.Equal(-1, rdn1.Compare(rdn4))
-	is.Equal(1, rdn4.Compare(rdn1))
-}
-
-func Test_DN(t *testing.T) {
-	is := is.New(t)
-	dn1, err := NewDN("dc=example, dc = com")
-	is.NoErr(err)
-	is.Equal(DN{RDN{"dc", "com"}, RDN{"dc", "example"}}, dn1)
-	is.True(dn1.IsAncestor(dn1))
-	is.Equal("dc=example,dc=com", dn1.String())
-
-	dn2, err := NewDN("o=example,dc=example,dc=com")
-	is.NoErr(err)
-	is.Equal(DN{RDN{"dc", "com"}, RDN{"dc", "example"}, RDN{"o", "example"}}, dn2)
-	is.True(dn1.IsAncestor(dn2)) // dn1 should be an ancestor of dn2
-
-	dn3, err := NewDN("")
-	is.NoErr(err)
-	is.Equal(DN{}, dn3)
-	is.True(dn3.IsAncestor(dn1)) // root should be an ancestor of dn1
-
-	dn4, err := NewDN("DC=example,Dc=com")
-	is.NoErr(err)
-	is.True(dn1.Equal(dn4))
-
-	dn5, err := NewDN(" \t\n")
-	is.NoErr(err)
-	is.True(dn5.IsEmpty())
-}
-
 func Test_DBAddEntries_Success(t *testing.T) {
 	is := is.New(t)
 	entries := []*Entry{
@@ -94,9 +40,23 @@ func Test_DBAddEntries_Success(t *testing.T) {
 	is.NoErr(err)
 
 	dit := db.DIT
-	is.Equal(1, len(dit.children))
-	is.Equal(DN{RDN{"dc", "com"}}, dit.children[0].Entry.DN)
-	is.Equal(6, len(dit.children[0].children))
+	is.Equal(2, len(dit.children)) // cn=Subschema and dc=com
+	is.Equal(DN{RDN{{"dc", "com"}}}, dit.children[1].Entry.DN)
+	is.Equal(6, len(dit.children[1].children))
+}
+
+func Test_DBNamingContexts(t *testing.T) {
+	is := is.New(t)
+	db := NewDB()
+	is.Equal(0, len(db.NamingContexts())) // cn=Subschema is not a naming context
+
+	entries := []*Entry{
+		{DN: MustDN(t, "ou=people,dc=example,dc=com")},
+		{DN: MustDN(t, "dc=example,dc=com")},
+		{DN: MustDN(t, "o=example")},
+	}
+	is.NoErr(db.AddEntries(entries))
+	is.Equal([]DN{MustDN(t, "dc=example,dc=com"), MustDN(t, "o=example")}, db.NamingContexts())
 }
 
 func Test_DBAddEntries_Duplicate(t *testing.T) {
@@ -110,6 +70,216 @@ func Test_DBAddEntries_Duplicate(t *testing.T) {
 	is.True(err != nil)
 }
 
+func Test_DBAddEntries_DuplicateIgnoreCase(t *testing.T) {
+	is := is.New(t)
+	entries := []*Entry{
+		{DN: MustDN(t, "dc=example,dc=com")},
+		{DN: MustDN(t, "DC=Example,domainComponent=COM")},
+	}
+	db := NewDB()
+	err := db.AddEntries(entries)
+	is.True(err != nil)
+}
+
+func Test_DBAddEntries_DistinctCaseExact(t *testing.T) {
+	is := is.New(t)
+	entries := []*Entry{
+		{DN: MustDN(t, "dc=example,dc=com")},
+		{DN: MustDN(t, "automountKey=home,dc=example,dc=com")},
+		{DN: MustDN(t, "automountKey=Home,dc=example,dc=com")},
+	}
+	db := NewDB()
+	err := db.AddEntries(entries)
+	is.NoErr(err)
+	is.Equal(2, len(db.DIT.children[1].children))
+}
+
+func Test_DBAddEntries_MultiValuedRDN(t *testing.T) {
+	is := is.New(t)
+	entries := []*Entry{
+		{DN: MustDN(t, "cn=home,cn=John Smith+uid=jsmith,dc=example,dc=com")},
+		{DN: MustDN(t, "dc=example,dc=com")},
+		{DN: MustDN(t, "cn=John Smith+uid=jsmith,dc=example,dc=com")},
+		{DN: MustDN(t, "cn=John Smith,dc=example,dc=com")},
+	}
+	db := NewDB()
+	is.NoErr(db.AddEntries(entries))
+	is.Equal(2, len(db.DIT.children[1].children))
+
+	node := db.DIT.Find(MustDN(t, "uid=jsmith+cn=john smith,dc=example,dc=com"))
+	is.True(node != nil)
+	is.Equal(entries[2], node.Entry)
+	is.Equal(1, len(node.children))
+
+	err := db.AddEntries([]*Entry{{DN: MustDN(t, "UID=jsmith+CN=John Smith,dc=example,dc=com")}})
+	is.True(err != nil) // duplicate DN
+}
+
+func Test_DBAddEntries_Normalized(t *testing.T) {
+	is := is.New(t)
+	entries := []*Entry{
+		{DN: MustDN(t, "dc=Example,dc=com")},
+		{DN: MustDN(t, "2.5.4.3=John Smith,DC=example,dc=COM")},
+	}
+	db := NewDB()
+	is.NoErr(db.AddEntries(entries))
+	is.Equal(1, len(db.DIT.children[1].children)) // cn=John Smith is under dc=Example
+
+	node := db.DIT.Find(MustDN(t, "CN=john smith,dc=EXAMPLE,dc=com"))
+	is.True(node != nil)
+	is.Equal(entries[1], node.Entry)
+	// The DN is kept as it was given
+	is.Equal("2.5.4.3=John Smith,DC=example,dc=COM", node.Entry.DN.String())
+
+	err := db.AddEntries([]*Entry{{DN: MustDN(t, "commonName=JOHN SMITH,dc=example,dc=com")}})
+	is.True(err != nil) // duplicate DN
+}
+
+func Test_DBAddEntries_Invalid(t *testing.T) {
+	is := is.New(t)
+	entries := []*Entry{
+		{DN: MustDN(t, "dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"domain"}},
+			"dc":          {"dc", []string{"example"}},
+		}},
+		{DN: MustDN(t, "ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"organizationalUnit"}},
+		}},
+		{DN: MustDN(t, "ou=groups,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"organizationalUnit"}},
+			"ou":          {"ou", []string{"groups"}},
+			"gidnumber":   {"gidNumber", []string{"1000"}},
+		}},
+	}
+	db := NewDB()
+	db.ValidateEntries = true
+	err := db.AddEntries(entries)
+	is.True(errors.Is(err, ErrSchemaViolation))
+	is.Equal("schema violation: ou=people,dc=example,dc=com: missing required attribute ou\n"+
+		"schema violation: ou=groups,dc=example,dc=com: attribute gidNumber not allowed by object classes", err.Error())
+	is.Equal(1, len(db.DIT.children)) // no entries added, just cn=Subschema
+
+	db.ValidateEntries = false
+	is.NoErr(db.AddEntries(entries))
+}
+
+func Test_DBAddEntries_RDNAttrs(t *testing.T) {
+	newEntries := func() []*Entry {
+		return []*Entry{
+			{DN: MustDN(t, "dc=example,dc=com"), Attrs: map[string]Attr{
+				"objectclass": {"objectClass", []string{"domain"}},
+				"dc":          {"dc", []string{"Example"}},
+			}},
+			{DN: MustDN(t, "ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+				"objectclass": {"objectClass", []string{"organizationalUnit"}},
+			}},
+			{DN: MustDN(t, "cn=Alice Smith+uid=alice,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+				"objectclass": {"objectClass", []string{"inetOrgPerson"}},
+				"cn":          {"cn", []string{"Alice"}},
+				"sn":          {"sn", []string{"Smith"}},
+			}},
+		}
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		is := is.New(t)
+		entries := newEntries()
+		db := NewDB()
+		is.NoErr(db.AddEntries(entries))
+		_, ok := entries[1].GetAttr("ou")
+		is.True(!ok)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		is := is.New(t)
+		entries := newEntries()
+		db := NewDB()
+		db.RDNAttrs = RDNAttrsAdd
+		db.ValidateEntries = true
+		is.NoErr(db.AddEntries(entries))
+		dc, _ := entries[0].GetAttr("dc")
+		is.Equal([]string{"Example"}, dc.Vals) // already present, ignoring case
+		ou, _ := entries[1].GetAttr("ou")
+		is.Equal(Attr{Name: "ou", Vals: []string{"people"}}, ou)
+		cn, _ := entries[2].GetAttr("cn")
+		is.Equal([]string{"Alice", "Alice Smith"}, cn.Vals)
+		uid, _ := entries[2].GetAttr("uid")
+		is.Equal([]string{"alice"}, uid.Vals)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		is := is.New(t)
+		db := NewDB()
+		db.RDNAttrs = RDNAttrsReject
+		err := db.AddEntries(newEntries())
+		is.True(errors.Is(err, ErrSchemaViolation))
+		is.Equal("schema violation: ou=people,dc=example,dc=com: missing RDN value ou=people\n"+
+			"schema violation: cn=Alice Smith+uid=alice,ou=people,dc=example,dc=com: missing RDN value cn=Alice Smith\n"+
+			"schema violation: cn=Alice Smith+uid=alice,ou=people,dc=example,dc=com: missing RDN value uid=alice", err.Error())
+		is.Equal(1, len(db.DIT.children)) // no entries added, just cn=Subschema
+	})
+}
+
+func Test_DBAddEntries_Orphans(t *testing.T) {
+	entries := func() []*Entry {
+		return []*Entry{
+			{DN: MustDN(t, "cn=x,ou=missing,dc=example,dc=com")},
+			{DN: MustDN(t, "uid=y,ou=people,o=missing,dc=example,dc=com")},
+			{DN: MustDN(t, "dc=example,dc=com")},
+			{DN: MustDN(t, "ou=people,dc=example,dc=com")},
+			{DN: MustDN(t, "uid=z,ou=people,dc=example,dc=com")},
+			{DN: MustDN(t, "ou=other,dc=example2,dc=com")}, // top of a naming context
+		}
+	}
+
+	t.Run("allow", func(t *testing.T) {
+		is := is.New(t)
+		db := NewDB()
+		is.NoErr(db.AddEntries(entries()))
+		is.True(db.DIT.Find(MustDN(t, "cn=x,ou=missing,dc=example,dc=com")) != nil)
+		is.Equal(nil, db.DIT.Find(MustDN(t, "ou=missing,dc=example,dc=com")))
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		is := is.New(t)
+		db := NewDB()
+		db.Orphans = OrphansReject
+		err := db.AddEntries(entries())
+		is.True(errors.Is(err, ErrOrphanEntry))
+		is.Equal("orphan entry: cn=x,ou=missing,dc=example,dc=com: parent ou=missing,dc=example,dc=com does not exist\n"+
+			"orphan entry: uid=y,ou=people,o=missing,dc=example,dc=com: parent ou=people,o=missing,dc=example,dc=com does not exist", err.Error())
+		is.Equal(1, len(db.DIT.children)) // no entries added, just cn=Subschema
+
+		// The parent may already be in the DB.
+		is.NoErr(db.AddEntries(entries()[2:]))
+		is.NoErr(db.AddEntries([]*Entry{{DN: MustDN(t, "uid=a,ou=people,dc=example,dc=com")}}))
+		err = db.AddEntries([]*Entry{{DN: MustDN(t, "uid=a,ou=missing,dc=example,dc=com")}})
+		is.True(errors.Is(err, ErrOrphanEntry))
+	})
+
+	t.Run("create", func(t *testing.T) {
+		is := is.New(t)
+		db := NewDB()
+		db.Orphans = OrphansCreate
+		is.NoErr(db.AddEntries(entries()))
+
+		node := db.DIT.Find(MustDN(t, "ou=missing,dc=example,dc=com"))
+		is.True(node != nil)
+		is.Equal(&Entry{DN: MustDN(t, "ou=missing,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"top", "organizationalUnit", "extensibleObject"}},
+			"ou":          {"ou", []string{"missing"}},
+		}, Origin: OriginPlaceholder}, node.Entry)
+		is.Equal(1, len(node.children))
+
+		node = db.DIT.Find(MustDN(t, "ou=people,o=missing,dc=example,dc=com"))
+		is.True(node != nil)
+		is.Equal(1, len(node.children))
+		o, _ := db.DIT.Find(MustDN(t, "o=missing,dc=example,dc=com")).Entry.GetAttr("objectClass")
+		is.Equal([]string{"top", "organization", "extensibleObject"}, o.Vals)
+		is.Equal(nil, db.DIT.Find(MustDN(t, "dc=example2,dc=com")))
+	})
+}
+
 func Test_DIT_String(t *testing.T) {
 	is := is.New(t)
 	entries := []*Entry{
@@ -120,7 +290,8 @@ func Test_DIT_String(t *testing.T) {
 		{DN: MustDN(t, "uid=bob,ou=people,dc=example,dc=com")},
 		{DN: MustDN(t, "cn=employees,ou=groups,dc=example,dc=com")},
 	}
-	expected := "dc=example,dc=com\n" +
+	expected := "cn=Subschema\n" +
+		"dc=example,dc=com\n" +
 		"  ou=people\n    uid=alice\n    uid=bob\n" +
 		"  ou=groups\n    cn=employees\n"
 
@@ -165,6 +336,29 @@ func Test_Entry_CaseInsensitiveAttrs(t *testing.T) {
 	is.Equal(emap["objectClass"], a.Vals[0])
 }
 
+func Test_Entry_SchemaAttrs(t *testing.T) {
+	is := is.New(t)
+	emap := map[string]any{
+		"dn":            "uid=jsmith,dc=example,dc=com",
+		"objectClass":   "posixAccount",
+		"commonName":    "John Smith",
+		"homeDirectory": "/home/JSmith",
+	}
+	e, err := NewEntryFromMap(emap)
+	is.NoErr(err)
+
+	a, ok := e.GetAttr("cn")
+	is.True(ok)
+	is.Equal("commonName", a.Name)
+	_, ok = e.GetAttr("2.5.4.3")
+	is.True(ok)
+
+	a, ok = e.GetAttr("homeDirectory")
+	is.True(ok)
+	is.True(a.HasValue("/home/JSmith"))
+	is.True(!a.HasValue("/home/jsmith")) // caseExactIA5Match
+}
+
 func Test_Entry_Auth(t *testing.T) {
 	type testcase struct {
 		name         string
@@ -277,6 +471,125 @@ func Test_Entry_Auth(t *testing.T) {
 			userPassword: "{SSHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
 			expectErr:    ErrMissingSalt,
 		},
+		{
+			name:        "SHA-1",
+			objectClass: "posixAccount",
+			// echo -n password | openssl dgst -binary -sha1 | openssl base64
+			userPassword: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		},
+		{
+			name:        "SHA-1 wrong password",
+			objectClass: "posixAccount",
+			// echo -n wrong | openssl dgst -binary -sha1 | openssl base64
+			userPassword: "{SHA}pLSKgc2rHhpd03kH1shcocYd3Hw=",
+			expectErr:    ErrAuthenticationFailed,
+		},
+		{
+			name:         "SHA-1 wrong length",
+			objectClass:  "posixAccount",
+			userPassword: "{SHA}bm90LWhhc2hlZA==",
+			expectErr:    ErrMalformedHashtext,
+		},
+		{
+			name:        "MD5",
+			objectClass: "posixAccount",
+			// echo -n password | openssl dgst -binary -md5 | openssl base64
+			userPassword: "{MD5}X03MO1qnZdYdgyfeuILPmQ==",
+		},
+		{
+			name:        "Salted MD5",
+			objectClass: "posixAccount",
+			// (echo -n password0123 | openssl dgst -binary -md5; echo -n 0123) | openssl base64
+			userPassword: "{SMD5}Ms7Ir8fCaDlXQJnNvo6t1jAxMjM=",
+		},
+		{
+			name:        "Salted MD5 scheme",
+			objectClass: "posixAccount",
+			scheme:      "SMD5",
+		},
+		{
+			name:        "MD5-crypt",
+			objectClass: "posixAccount",
+			// openssl passwd -1 -salt abcdefgh password
+			userPassword: "{CRYPT}$1$abcdefgh$G//4keteveJp0qb8z2DxG/",
+		},
+		{
+			name:        "SHA-256-crypt",
+			objectClass: "posixAccount",
+			// openssl passwd -5 -salt saltsalt password
+			userPassword: "{CRYPT}$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC.",
+		},
+		{
+			name:        "SHA-512-crypt",
+			objectClass: "posixAccount",
+			// openssl passwd -6 -salt saltsalt password
+			userPassword: "{CRYPT}$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/",
+		},
+		{
+			name:         "lower-case scheme",
+			objectClass:  "posixAccount",
+			userPassword: "{crypt}$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/",
+		},
+		{
+			name:        "SHA-512-crypt wrong password",
+			objectClass: "posixAccount",
+			// openssl passwd -6 -salt saltsalt wrong
+			userPassword: "{CRYPT}$6$saltsalt$QllWaR3syVkXRkZsU7l/GOpFdqNIVj6vP0E9nt8Kk1dAKC9mtyBopBy6aytyZzf6UgZ1rd1p94xTTUvEB3bOD/",
+			expectErr:    ErrAuthenticationFailed,
+		},
+		{
+			name:         "unsupported crypt",
+			objectClass:  "posixAccount",
+			userPassword: "{CRYPT}$2y$05$bvIG6Nmid91Mu9RcmmWZfO5HJIMCT8riNW0hEp8f6/FuA2/mHZFpe",
+			expectErr:    ErrUnsupportedCrypt,
+		},
+		{
+			name:        "PBKDF2",
+			objectClass: "posixAccount",
+			// passlib.hash.ldap_pbkdf2_sha1
+			userPassword: "{PBKDF2}1212$OB.dtnSEXZK8U5cgxU/GYQ$y5LKPOplRmok7CZp/aqVDVg8zGI",
+		},
+		{
+			name:         "PBKDF2-SHA1",
+			objectClass:  "posixAccount",
+			userPassword: "{PBKDF2-SHA1}1212$OB.dtnSEXZK8U5cgxU/GYQ$y5LKPOplRmok7CZp/aqVDVg8zGI",
+		},
+		{
+			name:        "PBKDF2-SHA256",
+			objectClass: "posixAccount",
+			// passlib.hash.ldap_pbkdf2_sha256
+			userPassword: "{PBKDF2-SHA256}1212$4vjV83LKPjQzk31VI4E0Vw$hsYF68OiOUPdDZ1Fg.fJPeq1h/gXXY7acBp9/6c.tmQ",
+		},
+		{
+			name:        "PBKDF2-SHA512",
+			objectClass: "posixAccount",
+			// passlib.hash.ldap_pbkdf2_sha512
+			userPassword: "{PBKDF2-SHA512}1212$RHY0Fr3IDMSVO/RSZyb5ow$eNLfBK.eVozomMr.1gYa17k9B7KIK25NOEshvhrSX.esqY3s.FvWZViXz4KoLlQI.BzY/YTNJOiKc5gBYFYGww",
+		},
+		{
+			name:         "PBKDF2 wrong hash",
+			objectClass:  "posixAccount",
+			userPassword: "{PBKDF2-SHA256}1212$OB.dtnSEXZK8U5cgxU/GYQ$y5LKPOplRmok7CZp/aqVDVg8zGI",
+			expectErr:    ErrAuthenticationFailed,
+		},
+		{
+			name:         "PBKDF2 missing salt",
+			objectClass:  "posixAccount",
+			userPassword: "{PBKDF2}1212$y5LKPOplRmok7CZp/aqVDVg8zGI",
+			expectErr:    ErrMalformedHashtext,
+		},
+		{
+			name:         "PBKDF2 invalid iterations",
+			objectClass:  "posixAccount",
+			userPassword: "{PBKDF2}0$OB.dtnSEXZK8U5cgxU/GYQ$y5LKPOplRmok7CZp/aqVDVg8zGI",
+			expectErr:    ErrMalformedHashtext,
+		},
+		{
+			name:         "PBKDF2 malformed base64",
+			objectClass:  "posixAccount",
+			userPassword: "{PBKDF2}1212$OB+dtnSEXZK8U5cgxU/GYQ$y5LKPOplRmok7CZp/aqVDVg8zGI",
+			expectErr:    ErrMalformedBase64,
+		},
 	}
 
 	for _, tt := range testcases {
@@ -292,6 +605,7 @@ func hashPassword(t *testing.T, password string, scheme string) string {
 		"SSHA":    sha1.New,
 		"SSHA256": sha256.New,
 		"SSHA512": sha512.New,
+		"SMD5":    md5.New,
 	}
 
 	is.True(newHash[scheme] != nil)
@@ -305,3 +619,125 @@ func hashPassword(t *testing.T, password string, scheme string) string {
 
 	return "{" + scheme + "}" + base64.StdEncoding.EncodeToString(append(h.Sum(nil), salt...))
 }
+
+func Test_Soundex(t *testing.T) {
+	is := is.New(t)
+	tests := map[string]string{
+		"robert":   "r163",
+		"rupert":   "r163",
+		"rubin":    "r150",
+		"ashcraft": "a261",
+		"ashcroft": "a261",
+		"tymczak":  "t522",
+		"pfister":  "p236",
+		"honeyman": "h555",
+		"lee":      "l000",
+		"o'hara":   "o'hara",
+	}
+	for word, code := range tests {
+		is.Equal(code, soundex(word))
+	}
+}
+
+func Test_DBCompare(t *testing.T) {
+	type testcase struct {
+		dn      string
+		attr    string
+		value   string
+		want    bool
+		wantErr error
+	}
+
+	db := NewDB()
+	err := db.AddEntries([]*Entry{
+		{DN: MustDN(t, "cn=admins,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"groupOfNames"}},
+			"cn":          {"cn", []string{"admins"}},
+			"member":      {"member", []string{"uid=alice,ou=people,dc=example,dc=com"}},
+		}},
+	})
+	is.New(t).NoErr(err)
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		got, err := db.Compare(MustDN(t, tt.dn), tt.attr, tt.value)
+		is.Equal(tt.wantErr, err)
+		is.Equal(tt.want, got)
+	}
+
+	tests := map[string]testcase{
+		"true":              {dn: "cn=admins,dc=example,dc=com", attr: "cn", value: "admins", want: true},
+		"true ignore case":  {dn: "CN=Admins,dc=example,dc=com", attr: "CN", value: "ADMINS", want: true},
+		"false":             {dn: "cn=admins,dc=example,dc=com", attr: "cn", value: "users", want: false},
+		"dn value":          {dn: "cn=admins,dc=example,dc=com", attr: "member", value: "UID=alice, ou=People,dc=example,dc=com", want: true},
+		"dn value false":    {dn: "cn=admins,dc=example,dc=com", attr: "member", value: "uid=bob,ou=people,dc=example,dc=com", want: false},
+		"oid":               {dn: "cn=admins,dc=example,dc=com", attr: "2.5.4.3", value: "admins", want: true},
+		"no such object":    {dn: "cn=users,dc=example,dc=com", attr: "cn", value: "users", wantErr: LDAPError(gldap.ResultNoSuchObject)},
+		"no such attribute": {dn: "cn=admins,dc=example,dc=com", attr: "description", value: "x", wantErr: LDAPError(gldap.ResultNoSuchAttribute)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DBAddEntries_Layers(t *testing.T) {
+	is := is.New(t)
+	entry := func(dn, desc string, origin Origin) *Entry {
+		return &Entry{DN: MustDN(t, dn), Origin: origin, Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"organizationalUnit"}},
+			"description": {"description", []string{desc}},
+		}}
+	}
+	desc := func(db *DB, dn string) string {
+		node := db.DIT.Find(MustDN(t, dn))
+		is.True(node != nil)
+		a, _ := node.Entry.GetAttr("description")
+		return a.Vals[0]
+	}
+
+	db := NewDB()
+	db.Orphans = OrphansCreate
+	is.NoErr(db.AddEntries([]*Entry{
+		entry("ou=a,dc=example,dc=com", "static", OriginStatic),
+		entry("ou=b,dc=example,dc=com", "files", OriginFiles),
+		entry("ou=c,dc=example,dc=com", "files", OriginFiles),
+		entry("ou=x,ou=d,dc=example,dc=com", "files", OriginFiles),
+	}))
+	is.NoErr(db.AddEntries([]*Entry{
+		entry("ou=A,dc=example,dc=com", "files", OriginFiles),
+		entry("ou=b,dc=example,dc=com", "static", OriginStatic),
+		entry("ou=c,dc=example,dc=com", "ldap", OriginLDAP),
+		entry("ou=d,dc=example,dc=com", "files", OriginFiles),
+	}))
+
+	is.Equal("static", desc(db, "ou=a,dc=example,dc=com")) // static kept over files
+	is.Equal("static", desc(db, "ou=b,dc=example,dc=com")) // static replaces files
+	is.Equal("ldap", desc(db, "ou=c,dc=example,dc=com"))   // ldap replaces files
+	is.Equal("files", desc(db, "ou=d,dc=example,dc=com"))  // files replaces placeholder
+	is.Equal(OriginStatic, db.DIT.Find(MustDN(t, "ou=a,dc=example,dc=com")).Entry.Origin)
+	is.Equal(1, len(db.DIT.Find(MustDN(t, "ou=d,dc=example,dc=com")).children))
+
+	// Entries of the same precedence are still duplicates.
+	err := db.AddEntries([]*Entry{entry("ou=c,dc=example,dc=com", "ldap", OriginLDAP)})
+	is.True(errors.Is(err, ErrDuplicateDN))
+}
+
+func Test_Entry_Origin(t *testing.T) {
+	is := is.New(t)
+	e := &Entry{DN: MustDN(t, "cn=a,dc=example,dc=com"), Origin: OriginFiles, Attrs: map[string]Attr{
+		"cn": {"cn", []string{"a"}},
+	}}
+	oe := e.withOrigin()
+	is.Equal([]Attr{{"cn", []string{"a"}}}, oe.SelectAttrs(nil))
+	is.Equal([]Attr{{"flapjakOrigin", []string{"files"}}}, oe.SelectAttrs([]string{"+"}))
+	is.Equal([]Attr{{"flapjakOrigin", []string{"files"}}}, oe.SelectAttrs([]string{"FlapjakOrigin"}))
+	_, ok := e.GetAttr("flapjakOrigin")
+	is.True(!ok) // e not modified
+
+	db := NewDB()
+	is.NoErr(db.AddEntries([]*Entry{e}))
+	got, err := db.Compare(e.DN, "flapjakOrigin", "FILES")
+	is.NoErr(err)
+	is.True(got)
+}
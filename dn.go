@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// RDN (Relative Distinguished Name) is a single element of a DN (Distinguished
+// Name) and is a set of one or more attribute value assertions (AVAs), each
+// naming an attribute and a value. Most RDNs have a single AVA. A multi-valued
+// RDN has several, each with a different attribute. The order of the AVAs is
+// not significant when RDNs are compared (see [RDN.Equal]) but is preserved
+// when formatted. In string form, RDNs are of the form "name=value" as
+// described by [RFC 4514], with multiple AVAs separated by "+", e.g.
+// "cn=John Smith+uid=jsmith".
+//
+// [RFC 4514]: https://datatracker.ietf.org/doc/html/rfc4514
+type RDN []AVA
+
+// AVA (Attribute Value Assertion) is a single name/value pair of an RDN. When
+// compared, AVA names and values are compared according to the schema (see
+// [AVA.Compare]). In string form, special characters in the value are escaped
+// with a backslash. Value holds the unescaped value.
+type AVA struct{ Name, Value string }
+
+// DN is a parsed DN string into a slice of RDNs, in the reverse order they
+// are in the string. Each RDN is separated by a comma, or a semicolon in
+// older DN strings, and may contain whitespace around it, which is stripped.
+type DN []RDN
+
+// dnSpecialChars are the characters that must be escaped with a backslash
+// anywhere in the string form of an attribute value of an RDN, as described
+// in [RFC 4514, section 2.4].
+//
+// [RFC 4514, section 2.4]: https://datatracker.ietf.org/doc/html/rfc4514#section-2.4
+const dnSpecialChars = `"+,;<>\`
+
+// ParseRDN parse a RDN string value, returning an RDN or an error if it could
+// not be parsed. The format must be "name=value" as described by [RFC 4514,
+// section 3], with optional whitespace around the "=", or a number of them
+// separated by "+". name is mandatory and must be an attribute type name or
+// numeric OID. value may be empty. The names in a multi-valued RDN must all
+// name different attributes.
+//
+// [RFC 4514, section 3]: https://datatracker.ietf.org/doc/html/rfc4514#section-3
+func ParseRDN(rdn string) (RDN, error) {
+	p := &dnParser{s: rdn, what: "rdn"}
+	result, err := p.rdn()
+	if err == nil && !p.atEnd() {
+		err = p.errorf("unexpected %q", p.s[p.pos])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// String returns rdn in string form, with its AVAs in their original order
+// separated by "+". It implements the [fmt.Stringer] interface.
+func (rdn RDN) String() string {
+	elems := make([]string, len(rdn))
+	for i, ava := range rdn {
+		elems[i] = ava.String()
+	}
+	return strings.Join(elems, "+")
+}
+
+// String returns ava in string form, escaping the value as described in
+// [RFC 4514, section 2.4]. It implements the [fmt.Stringer] interface.
+//
+// [RFC 4514, section 2.4]: https://datatracker.ietf.org/doc/html/rfc4514#section-2.4
+func (ava AVA) String() string {
+	return ava.Name + "=" + escapeDNValue(ava.Value)
+}
+
+// escapeDNValue escapes the special characters of an attribute value in an
+// RDN, as well as a leading space or '#', a trailing space and NUL.
+func escapeDNValue(val string) string {
+	var b strings.Builder
+	for i, c := range []byte(val) {
+		switch {
+		case strings.IndexByte(dnSpecialChars, c) != -1,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(val)-1 && c == ' ':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Equal compares rdn to rhs returning true if they are equal and false if not.
+// RDNs are equal if they have the same set of AVAs, in any order. AVAs are
+// compared with [AVA.Compare].
+func (rdn RDN) Equal(rhs RDN) bool {
+	return rdn.Compare(rhs) == 0
+}
+
+// Compare compares rdn to rhs returning -1 if rdn orders before rhs, 1 if it
+// orders after it and 0 if the are equal. The AVAs of each RDN are sorted
+// before being compared in turn with [AVA.Compare], so the order of the AVAs
+// is not significant. Compare can be used as a comparison function for
+// [slices.CompareFunc] and similar functions.
+func (rdn RDN) Compare(rhs RDN) int {
+	if len(rdn) == 1 && len(rhs) == 1 {
+		return rdn[0].Compare(rhs[0])
+	}
+	return slices.CompareFunc(rdn.sorted(), rhs.sorted(), AVA.Compare)
+}
+
+// sorted returns a copy of rdn with its AVAs sorted by [AVA.Compare].
+func (rdn RDN) sorted() RDN {
+	return slices.SortedFunc(slices.Values(rdn), AVA.Compare)
+}
+
+// Compare compares ava to rhs returning -1 if ava orders before rhs, 1 if it
+// orders after it and 0 if the are equal. The attribute names are equal if
+// they name the same attribute type in the schema, or are equal
+// case-insensitively if not in the schema. The values are compared with the
+// equality matching rule of the attribute (see [Schema.EqualityRule]) if the
+// names compare equal, falling back to a case-sensitive comparison if a value
+// is not valid for the rule.
+func (ava AVA) Compare(rhs AVA) int {
+	lname, rname := schema.attrKey(ava.Name), schema.attrKey(rhs.Name)
+	switch {
+	case lname < rname:
+		return -1
+	case lname > rname:
+		return +1
+	}
+	if c, ok := schema.EqualityRule(ava.Name).Compare(ava.Value, rhs.Value); ok {
+		return c
+	}
+	return strings.Compare(ava.Value, rhs.Value)
+}
+
+// NewDN constructs a DN from the given string representing a DN. If any of the
+// RDN components in the DN string are invalid (see [ParseRDN]), an error is
+// returned.
+func NewDN(dnstr string) (DN, error) {
+	if strings.TrimSpace(dnstr) == "" {
+		// The empty DN string is the root DN.
+		return DN{}, nil
+	}
+
+	p := &dnParser{s: dnstr, what: "dn"}
+	var result DN
+	for {
+		rdn, err := p.rdn()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rdn)
+		if p.atEnd() {
+			break
+		}
+		if p.s[p.pos] != ',' && p.s[p.pos] != ';' {
+			return nil, p.errorf("unexpected %q", p.s[p.pos])
+		}
+		p.pos++
+	}
+	slices.Reverse(result)
+	return result, nil
+}
+
+// String formats dn into a string representation of the DN and returns it.
+// The RDN values are escaped as described in [RFC 4514, section 2.4], so the
+// string can be parsed back to an equal DN with [NewDN].
+//
+// [RFC 4514, section 2.4]: https://datatracker.ietf.org/doc/html/rfc4514#section-2.4
+func (dn DN) String() string {
+	elems := make([]string, 0, len(dn))
+	for i := len(dn) - 1; i >= 0; i-- {
+		elems = append(elems, dn[i].String())
+	}
+	return strings.Join(elems, ",")
+}
+
+// Normalize returns the normalised form of dn. Attribute names are replaced
+// by the lower-case primary name of their attribute type in the schema, so
+// that names differing in case or given as a numeric OID (e.g. "2.5.4.3" for
+// "cn") are the same, and values are normalised by the equality matching rule
+// of their attribute (see [Schema.EqualityRule]), so that values that match
+// are the same (e.g. "Example" and "example" for dc, which is matched with
+// caseIgnoreMatch). Values that are not valid for the matching rule are left
+// unchanged. The AVAs of each RDN are sorted by name.
+//
+// Two DNs are equal if their normalised forms are identical.
+func (dn DN) Normalize() DN {
+	norm := make(DN, len(dn))
+	for i, rdn := range dn {
+		norm[i] = make(RDN, len(rdn))
+		for j, ava := range rdn {
+			norm[i][j].Name = schema.attrKey(ava.Name)
+			norm[i][j].Value = ava.Value
+			if v, ok := schema.EqualityRule(ava.Name).Normalize(ava.Value); ok {
+				norm[i][j].Value = v
+			}
+		}
+		// Names are unique within an RDN, so this is a canonical order.
+		slices.SortFunc(norm[i], func(a, b AVA) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return norm
+}
+
+// rdnStrings returns the string form of each RDN of dn.
+func (dn DN) rdnStrings() []string {
+	strs := make([]string, len(dn))
+	for i, rdn := range dn {
+		strs[i] = rdn.String()
+	}
+	return strs
+}
+
+// IsAncestor returns whether dn is an ancestor of sub. A dn is an ancestor
+// of sub if dn matches the leading elements of sub. A DN is an ancestor of itself.
+func (dn DN) IsAncestor(sub DN) bool {
+	if len(dn) > len(sub) {
+		return false
+	}
+	for i := range dn {
+		if !dn[i].Equal(sub[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if dn is equal to rhs.
+func (dn DN) Equal(rhs DN) bool {
+	return slices.EqualFunc(dn, rhs, RDN.Equal)
+}
+
+// CommonAncestor returns a DN that has the common ancestor of dn and other.
+// If there is no common ancestor, the root DN is returned.
+func (dn DN) CommonAncestor(other DN) DN {
+	common := make(DN, 0, min(len(dn), len(other)))
+	for i := range cap(common) {
+		if !dn[i].Equal(other[i]) {
+			break
+		}
+		common = append(common, dn[i])
+	}
+	return common
+}
+
+// Tail returns the parts of dn after the common ancestor of dn and head.
+func (dn DN) Tail(head DN) DN {
+	c := dn.CommonAncestor(head)
+	return dn[len(c):]
+}
+
+// IsEmpty returns true if dn is the root DN. The root DN has no components.
+func (dn DN) IsEmpty() bool {
+	return len(dn) == 0
+}
+
+// dnParser parses the string representation of a DN or RDN, as described by
+// [RFC 4514, section 3]. Unlike the RFC, whitespace is permitted around the
+// "=" of an RDN and the "," between RDNs, and around the whole DN, as was
+// allowed by [RFC 1779]. The whitespace is not part of the name or value
+// unless it is escaped. For compatibility with DN strings written for those
+// earlier RFCs, as [RFC 4514, section 4] suggests, RDNs may also be separated
+// by ";", and '"', '<' and '>' need not be escaped in values.
+//
+// [RFC 4514, section 3]: https://datatracker.ietf.org/doc/html/rfc4514#section-3
+// [RFC 4514, section 4]: https://datatracker.ietf.org/doc/html/rfc4514#section-4
+// [RFC 1779]: https://datatracker.ietf.org/doc/html/rfc1779
+type dnParser struct {
+	s    string
+	pos  int
+	what string // "dn" or "rdn", for error messages
+}
+
+func (p *dnParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid %s: %q: %s", p.what, p.s, fmt.Sprintf(format, args...))
+}
+
+func (p *dnParser) atEnd() bool {
+	return p.pos == len(p.s)
+}
+
+func (p *dnParser) skipSpace() {
+	for !p.atEnd() && isDNSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+// isDNSpace returns whether c is whitespace that may surround the names,
+// values and separators in a DN string.
+func isDNSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// rdn parses one or more name=value pairs separated by "+", and any
+// whitespace following them.
+func (p *dnParser) rdn() (RDN, error) {
+	var rdn RDN
+	for {
+		ava, err := p.ava()
+		if err != nil {
+			return nil, err
+		}
+		key := schema.attrKey(ava.Name)
+		if slices.ContainsFunc(rdn, func(a AVA) bool { return schema.attrKey(a.Name) == key }) {
+			return nil, p.errorf("attribute %q repeated in rdn", ava.Name)
+		}
+		rdn = append(rdn, ava)
+		if p.atEnd() || p.s[p.pos] != '+' {
+			return rdn, nil
+		}
+		p.pos++
+	}
+}
+
+// ava parses a single name=value pair, and any whitespace following it.
+func (p *dnParser) ava() (AVA, error) {
+	p.skipSpace()
+	name, err := p.attrType()
+	if err != nil {
+		return AVA{}, err
+	}
+	p.skipSpace()
+	if p.atEnd() || p.s[p.pos] != '=' {
+		return AVA{}, p.errorf("missing '=' after %q", name)
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.attrValue()
+	if err != nil {
+		return AVA{}, err
+	}
+	p.skipSpace()
+	return AVA{Name: name, Value: value}, nil
+}
+
+var (
+	dnDescrRegex      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	dnNumericOIDRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+)
+
+// attrType parses the attribute type of an RDN, which is either a name
+// (descr) or a numeric OID.
+func (p *dnParser) attrType() (string, error) {
+	start := p.pos
+	for !p.atEnd() && !isDNSpace(p.s[p.pos]) && strings.IndexByte("=,;+", p.s[p.pos]) == -1 {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+	switch {
+	case name == "":
+		return "", p.errorf("no attribute name")
+	case !dnDescrRegex.MatchString(name) && !dnNumericOIDRegex.MatchString(name):
+		return "", p.errorf("invalid attribute name %q", name)
+	}
+	return name, nil
+}
+
+// attrValue parses the value of an RDN, either as a string with escapes or
+// as a '#' followed by the hex of the BER encoding of the value. Unescaped
+// trailing whitespace is not part of the value.
+func (p *dnParser) attrValue() (string, error) {
+	if !p.atEnd() && p.s[p.pos] == '#' {
+		return p.hexValue()
+	}
+
+	var b []byte
+	valueLen := 0 // length of b without unescaped trailing spaces
+	for !p.atEnd() {
+		c := p.s[p.pos]
+		switch {
+		case c == ',' || c == ';' || c == '+':
+			return p.checkUTF8(b[:valueLen])
+		case c == '\\':
+			ec, n, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b = append(b, ec)
+			valueLen = len(b)
+			p.pos += n
+			continue
+		case c == 0:
+			return "", p.errorf("unescaped %q in value", c)
+		}
+		b = append(b, c)
+		if !isDNSpace(c) {
+			valueLen = len(b)
+		}
+		p.pos++
+	}
+	return p.checkUTF8(b[:valueLen])
+}
+
+// escape parses the escape sequence at the current position, returning the
+// byte it stands for and the length of the sequence. An escape is a backslash
+// followed by either a special character or two hex digits.
+func (p *dnParser) escape() (byte, int, error) {
+	rest := p.s[p.pos+1:]
+	if len(rest) >= 2 && isHexDigit(rest[0]) && isHexDigit(rest[1]) {
+		b, _ := hex.DecodeString(rest[:2])
+		return b[0], 3, nil
+	}
+	if rest != "" && strings.IndexByte(dnSpecialChars+" #=", rest[0]) != -1 {
+		return rest[0], 2, nil
+	}
+	return 0, 0, p.errorf("invalid escape sequence at position %d", p.pos)
+}
+
+func (p *dnParser) checkUTF8(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", p.errorf("value is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+// hexValue parses a value in the form of a '#' followed by the hex of its BER
+// encoding. The value must be a primitive BER element, such as an
+// OCTET STRING or one of the string types. Its contents are returned.
+func (p *dnParser) hexValue() (string, error) {
+	p.pos++ // skip '#'
+	start := p.pos
+	for !p.atEnd() && isHexDigit(p.s[p.pos]) {
+		p.pos++
+	}
+	b, err := hex.DecodeString(p.s[start:p.pos])
+	if err != nil || len(b) == 0 {
+		return "", p.errorf("invalid hex value %q", p.s[start:p.pos])
+	}
+	r := bytes.NewReader(b)
+	packet, err := ber.ReadPacket(r)
+	if err != nil || r.Len() != 0 || packet.TagType != ber.TypePrimitive {
+		return "", p.errorf("invalid BER value %q", p.s[start:p.pos])
+	}
+	return p.checkUTF8(packet.Data.Bytes())
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"cmp"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func MustDN(t *testing.T, dnstr string) DN {
+	is := is.New(t)
+	is.Helper()
+	dn, err := NewDN(dnstr)
+	is.NoErr(err)
+	return dn
+}
+
+func Test_RDN(t *testing.T) {
+	is := is.New(t)
+
+	rdn1 := RDN{{Name: "dc", Value: "example"}}
+	rdn2 := RDN{{Name: "DC", Value: "example"}}
+	rdn3 := RDN{{Name: "Dc", Value: "example2"}}
+	rdn4 := RDN{{Name: "ou", Value: "core"}}
+
+	is.True(rdn1.Equal(rdn1))
+	is.True(rdn2.Equal(rdn2))
+	is.True(!rdn1.Equal(rdn3))
+	is.True(!rdn1.Equal(rdn4))
+
+	is.Equal(-1, rdn1.Compare(rdn3))
+	is.Equal(1, rdn3.Compare(rdn2))
+	is.Equal(0, rdn1.Compare(rdn1))
+	is.Equal(0, rdn1.Compare(rdn2))
+	is.Equal(-1, rdn1.Compare(rdn4))
+	is.Equal(1, rdn4.Compare(rdn1))
+}
+
+func Test_RDN_MultiValued(t *testing.T) {
+	is := is.New(t)
+
+	rdn1, err := ParseRDN("cn=John Smith+uid=jsmith")
+	is.NoErr(err)
+	rdn2, err := ParseRDN("UID=jsmith+CN=john smith")
+	is.NoErr(err)
+	rdn3, err := ParseRDN("cn=John Smith")
+	is.NoErr(err)
+	rdn4, err := ParseRDN("cn=John Smith+uid=jsmith+sn=Smith")
+	is.NoErr(err)
+
+	is.True(rdn1.Equal(rdn2)) // order and case of AVAs is not significant
+	is.Equal(0, rdn1.Compare(rdn2))
+	is.True(!rdn1.Equal(rdn3))
+	is.True(!rdn1.Equal(rdn4))
+	is.Equal(1, rdn1.Compare(rdn3))
+	is.Equal(-1, rdn3.Compare(rdn1))
+	is.Equal("cn=John Smith+uid=jsmith", rdn1.String())
+	is.Equal("UID=jsmith+CN=john smith", rdn2.String()) // order preserved
+
+	dn1 := MustDN(t, "cn=John Smith+uid=jsmith,ou=people,dc=example,dc=com")
+	dn2 := MustDN(t, "uid=jsmith+cn=John Smith,ou=people,dc=example,dc=com")
+	is.True(dn1.Equal(dn2))
+	is.True(MustDN(t, "ou=people,dc=example,dc=com").IsAncestor(dn2))
+	is.True(!dn1.IsAncestor(MustDN(t, "cn=x,cn=John Smith,ou=people,dc=example,dc=com")))
+	is.True(dn1.IsAncestor(MustDN(t, "cn=x,uid=jsmith+cn=John Smith,ou=people,dc=example,dc=com")))
+}
+
+func Test_DN(t *testing.T) {
+	is := is.New(t)
+	dn1, err := NewDN("dc=example, dc = com")
+	is.NoErr(err)
+	is.Equal(DN{RDN{{"dc", "com"}}, RDN{{"dc", "example"}}}, dn1)
+	is.True(dn1.IsAncestor(dn1))
+	is.Equal("dc=example,dc=com", dn1.String())
+
+	dn2, err := NewDN("o=example,dc=example,dc=com")
+	is.NoErr(err)
+	is.Equal(DN{RDN{{"dc", "com"}}, RDN{{"dc", "example"}}, RDN{{"o", "example"}}}, dn2)
+	is.True(dn1.IsAncestor(dn2)) // dn1 should be an ancestor of dn2
+
+	dn3, err := NewDN("")
+	is.NoErr(err)
+	is.Equal(DN{}, dn3)
+	is.True(dn3.IsAncestor(dn1)) // root should be an ancestor of dn1
+
+	dn4, err := NewDN("DC=example,Dc=com")
+	is.NoErr(err)
+	is.True(dn1.Equal(dn4))
+
+	dn5, err := NewDN(" \t\n")
+	is.NoErr(err)
+	is.True(dn5.IsEmpty())
+}
+
+func Test_DN_Parse(t *testing.T) {
+	type testcase struct {
+		dn   string
+		want DN     // in RDN order, i.e. reverse of the string
+		str  string // canonical string form, if not the same as dn
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		dn, err := NewDN(tt.dn)
+		is.NoErr(err)
+		is.Equal(tt.want, dn)
+		is.Equal(cmp.Or(tt.str, tt.dn), dn.String())
+
+		// The string form must parse back to the same DN.
+		dn2, err := NewDN(dn.String())
+		is.NoErr(err)
+		is.Equal(dn, dn2)
+	}
+
+	tests := []testcase{
+		{
+			dn:   `cn=Smith\, John,ou=people,dc=example,dc=com`,
+			want: DN{{{"dc", "com"}}, {{"dc", "example"}}, {{"ou", "people"}}, {{"cn", "Smith, John"}}},
+		},
+		{dn: `cn=Smith\2C John`, want: DN{{{"cn", "Smith, John"}}}, str: `cn=Smith\, John`},
+		{dn: `cn=a\+b`, want: DN{{{"cn", "a+b"}}}},
+		{dn: `cn=\"quoted\"`, want: DN{{{"cn", `"quoted"`}}}},
+		{dn: `cn=back\\slash`, want: DN{{{"cn", `back\slash`}}}},
+		{dn: `cn=\<a\>\;b`, want: DN{{{"cn", "<a>;b"}}}},
+		{dn: `cn="quoted"`, want: DN{{{"cn", `"quoted"`}}}, str: `cn=\"quoted\"`},
+		{dn: `cn=<a>`, want: DN{{{"cn", "<a>"}}}, str: `cn=\<a\>`},
+		{dn: `cn=a;dc=com`, want: DN{{{"dc", "com"}}, {{"cn", "a"}}}, str: `cn=a,dc=com`},
+		{dn: `cn=a ; dc=com`, want: DN{{{"dc", "com"}}, {{"cn", "a"}}}, str: `cn=a,dc=com`},
+		{dn: `cn=a\=b`, want: DN{{{"cn", "a=b"}}}, str: `cn=a=b`},
+		{dn: `cn=a=b`, want: DN{{{"cn", "a=b"}}}},
+		{dn: `cn=\#hash`, want: DN{{{"cn", "#hash"}}}},
+		{dn: `cn=not#hash`, want: DN{{{"cn", "not#hash"}}}},
+		{dn: `cn=\ leading`, want: DN{{{"cn", " leading"}}}},
+		{dn: `cn=trailing\ `, want: DN{{{"cn", "trailing "}}}},
+		{dn: `cn=\ \ `, want: DN{{{"cn", "  "}}}},
+		{dn: `cn=in  side`, want: DN{{{"cn", "in  side"}}}},
+		{dn: `cn=caf\C3\A9`, want: DN{{{"cn", "café"}}}, str: "cn=café"},
+		{dn: "cn=café", want: DN{{{"cn", "café"}}}},
+		{dn: `cn=nul\00`, want: DN{{{"cn", "nul\x00"}}}},
+		{dn: `cn=#04024869`, want: DN{{{"cn", "Hi"}}}, str: "cn=Hi"},
+		{dn: `cn=#0C03E282AC`, want: DN{{{"cn", "€"}}}, str: "cn=€"},
+		{dn: `cn=`, want: DN{{{"cn", ""}}}},
+		{dn: `2.5.4.3=x`, want: DN{{{"2.5.4.3", "x"}}}},
+		{
+			dn:   "cn=John Smith+uid=jsmith,ou=people",
+			want: DN{{{"ou", "people"}}, {{"cn", "John Smith"}, {"uid", "jsmith"}}},
+		},
+		{dn: "uid=a\\+b + cn=c", want: DN{{{"uid", "a+b"}, {"cn", "c"}}}, str: "uid=a\\+b+cn=c"},
+		{dn: "dc=example , dc = com ", want: DN{{{"dc", "com"}}, {{"dc", "example"}}}, str: "dc=example,dc=com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dn, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DN_ParseError(t *testing.T) {
+	tests := []string{
+		`cn`,
+		`=value`,
+		`cn=a,`,
+		`,cn=a`,
+		`cn=a,,dc=com`,
+		`c n=a`,
+		`cn_x=a`,
+		`1.2.=a`,
+		`cn=a\`,
+		`cn=a\zz`,
+		`cn=a\C3`,
+		`cn=a;`,
+		`cn=a;;dc=com`,
+		"cn=a\x00",
+		`cn=a+`,
+		`+cn=a`,
+		`cn=a+cn=b`,
+		`cn=a+2.5.4.3=b`,
+		`cn=#`,
+		`cn=#zz`,
+		`cn=#0402`,
+		`cn=#040148AB`,
+		`cn=#3000`,
+		`cn=#04 02`,
+	}
+
+	for _, dn := range tests {
+		t.Run(dn, func(t *testing.T) {
+			is := is.New(t)
+			_, err := NewDN(dn)
+			is.True(err != nil)
+		})
+	}
+}
+
+func Test_ParseRDN(t *testing.T) {
+	is := is.New(t)
+
+	rdn, err := ParseRDN(` cn = Smith\, John `)
+	is.NoErr(err)
+	is.Equal(RDN{{"cn", "Smith, John"}}, rdn)
+	is.Equal(`cn=Smith\, John`, rdn.String())
+
+	_, err = ParseRDN("cn=a,dc=com")
+	is.True(err != nil) // more than one RDN
+	_, err = ParseRDN("")
+	is.True(err != nil) // no attribute name
+}
+
+func Test_DN_Normalize(t *testing.T) {
+	type testcase struct {
+		dn   string
+		want string
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		is.Equal(tt.want, MustDN(t, tt.dn).Normalize().String())
+	}
+
+	tests := []testcase{
+		{dn: "dc=Example,DC=COM", want: "dc=example,dc=com"},
+		{dn: "2.5.4.3=John  Smith,ou=People", want: "cn=john smith,ou=people"},
+		{dn: "commonName=x,organizationalUnitName=y", want: "cn=x,ou=y"},
+		{dn: "uid=JSmith+CN=John Smith", want: "cn=john smith+uid=jsmith"},
+		{dn: "automountKey=Home", want: "automountkey=Home"},     // caseExactMatch
+		{dn: "unknownAttr=Value", want: "unknownattr=value"},     // not in schema
+		{dn: "uidNumber=0042", want: "uidnumber=42"},             // integerMatch
+		{dn: "uidNumber=forty-two", want: "uidnumber=forty-two"}, // invalid for rule
+		{dn: `cn=Smith\, John`, want: `cn=smith\, john`},
+		{dn: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dn, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
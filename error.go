@@ -1,6 +1,10 @@
 package main
 
-import "github.com/jimlambrt/gldap"
+import (
+	"errors"
+
+	"github.com/jimlambrt/gldap"
+)
 
 type LDAPError uint16
 
@@ -14,3 +18,23 @@ func (e LDAPError) Error() string {
 func (e LDAPError) ResultCode() int {
 	return int(e)
 }
+
+// ResultCode returns the LDAP result code for an error returned by the DB
+// methods that add, modify and delete entries.
+func ResultCode(err error) int {
+	var ldapErr LDAPError
+	switch {
+	case err == nil:
+		return gldap.ResultSuccess
+	case errors.As(err, &ldapErr):
+		return ldapErr.ResultCode()
+	case errors.Is(err, ErrDuplicateDN):
+		return gldap.ResultEntryAlreadyExists
+	case errors.Is(err, ErrOrphanEntry):
+		return gldap.ResultNoSuchObject
+	case errors.Is(err, ErrSchemaViolation):
+		return gldap.ResultObjectClassViolation
+	default:
+		return gldap.ResultOther
+	}
+}
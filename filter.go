@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -17,6 +19,9 @@ var (
 	ErrEmptyAttrName    = errors.New("empty attribute name")
 	ErrEmptyAttrValue   = errors.New("empty attribute value")
 	ErrMissingOperation = errors.New("missing filter operation")
+	ErrMissingRule      = errors.New("missing matching rule")
+	ErrInvalidRule      = errors.New("invalid matching rule")
+	ErrInvalidEscape    = errors.New("invalid escape sequence")
 )
 
 // FilterNode represents an individual filter element of a parsed LDAP filter
@@ -28,9 +33,11 @@ type FilterNode interface {
 }
 
 // Parse parses an LDAP filter string into an [FilterNode] AST that can be
-// used to match against an LDAP Entry. If the filter string could not be
-// parsed due to a syntax error or unimplemented filter, an error is
-// returned with a nil FilterNode.
+// used to match against an LDAP Entry. The filter string syntax is described
+// in [RFC 4515]. If the filter string could not be parsed due to a syntax
+// error or unimplemented filter, an error is returned with a nil FilterNode.
+//
+// [RFC 4515]: https://datatracker.ietf.org/doc/html/rfc4515
 func Parse(filter string) (n FilterNode, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -103,60 +110,216 @@ func parseNotFilter(c *cursor) FilterNode {
 }
 
 func parseOpFilter(c *cursor) FilterNode {
-	rs := c.extractTo(')')
+	rs := c.extractItem()
 	c.expectRune(')')
 
-	var attr, op, value string
+	var attr, op string
+	var value []rune
 	switch idx := slices.Index(rs, '='); {
 	case idx == -1:
 		panice(ErrMissingOperation)
+	case idx > 0 && rs[idx-1] == ':':
+		// Extensible match has the attribute description, dn flag and
+		// matching rule before the op, separated by colons.
+		return parseExtensible(rs[:idx-1], rs[idx+1:])
 	case idx > 0 && isOp(string(rs[idx-1:idx+1])):
 		// 2-char op with second char being =
 		attr = validateAttrName(rs[:idx-1])
 		op = string(rs[idx-1 : idx+1])
-		value = string(rs[idx+1:])
+		value = rs[idx+1:]
 	default:
 		// Op is '='
 		attr = validateAttrName(rs[:idx])
 		op = string(rs[idx])
-		value = string(rs[idx+1:])
+		value = rs[idx+1:]
 	}
 
-	if value == "" {
+	if len(value) == 0 {
 		panice(ErrEmptyAttrValue)
 	}
 
-	if op == "=" && value == "*" {
-		return &Presence{Attr: attr}
-	}
 	if op == "=" {
-		// TODO: Implement Substring filters (value contains '*' globs)
-		return &Equality{Attr: attr, Value: value}
+		// Only an equality filter treats an unescaped '*' specially,
+		// as a presence or substring filter.
+		parts := decodeValue(value, true)
+		switch {
+		case len(parts) == 1:
+			return &Equality{Attr: attr, Value: parts[0]}
+		case len(parts) == 2 && parts[0] == "" && parts[1] == "":
+			return &Presence{Attr: attr}
+		default:
+			return newSubstring(attr, parts)
+		}
 	}
 
-	// TODO: Implement >= (Greater-Or-Equal) and <= (Less-Or-Equal) filters.
-	// TODO: Implement ~= (Approximate Match) filter (maybe)
-	panicf("%w: operation: %s", ErrUnimplemented, op)
+	v := decodeValue(value, false)[0]
+	switch op {
+	case ">=":
+		return &GreaterOrEqual{Attr: attr, Value: v}
+	case "<=":
+		return &LessOrEqual{Attr: attr, Value: v}
+	case "~=":
+		return &Approx{Attr: attr, Value: v}
+	}
+
+	panicf("%w: unknown operation: %s", ErrInternal, op)
+	// NOTREACHED
 	return nil
 }
 
-func validateAttrName(rs []rune) string {
-	if len(rs) == 0 {
-		panice(ErrEmptyAttrName)
+// newSubstring returns a substring filter from the parts of the value of a
+// substring filter of the form `[initial]*[any]*...*[final]` split at each
+// unescaped '*'. Each of initial, any and final are optional. Empty "any"
+// components (`**`) are ignored.
+func newSubstring(attr string, parts []string) FilterNode {
+	f := &Substring{Attr: attr, Initial: parts[0], Final: parts[len(parts)-1]}
+	for _, part := range parts[1 : len(parts)-1] {
+		if part != "" {
+			f.Any = append(f.Any, part)
+		}
+	}
+	return f
+}
+
+// decodeValue decodes the escape sequences of an assertion value as described
+// in [RFC 4515, section 3]. An escape sequence is a backslash followed by two
+// hex digits for the value of a byte. For compatibility with [RFC 1960], a
+// backslash followed by any of `*()\` is that character, unescaped.
+//
+// If splitStar is true, the value is split at each unescaped '*', and the
+// decoded parts between them are returned. Otherwise a single decoded value
+// is returned where an unescaped '*' is a literal '*'.
+//
+// [RFC 4515, section 3]: https://datatracker.ietf.org/doc/html/rfc4515#section-3
+// [RFC 1960]: https://datatracker.ietf.org/doc/html/rfc1960#section-3
+func decodeValue(rs []rune, splitStar bool) []string {
+	var parts []string
+	var part []byte
+	for i := 0; i < len(rs); i++ {
+		switch r := rs[i]; {
+		case r == '*' && splitStar:
+			parts = append(parts, string(part))
+			part = nil
+		case r != '\\':
+			part = utf8.AppendRune(part, r)
+		case i+2 < len(rs) && isHexRune(rs[i+1]) && isHexRune(rs[i+2]):
+			b, _ := strconv.ParseUint(string(rs[i+1:i+3]), 16, 8)
+			part = append(part, byte(b))
+			i += 2
+		case i+1 < len(rs) && strings.ContainsRune("*()\\", rs[i+1]):
+			part = append(part, byte(rs[i+1]))
+			i++
+		default:
+			panicf("%w: %s", ErrInvalidEscape, string(rs[i:min(i+3, len(rs))]))
+		}
+	}
+	return append(parts, string(part))
+}
+
+func isHexRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// parseExtensible parses an extensible match filter. desc is the part of the
+// filter before the ":=" and is of the form `[attr][:dn][:rule]`, where at
+// least one of attr or rule must be present.
+func parseExtensible(desc []rune, value []rune) FilterNode {
+	if len(value) == 0 {
+		panice(ErrEmptyAttrValue)
+	}
+
+	parts := strings.Split(string(desc), ":")
+	f := &ExtensibleMatch{}
+	if parts[0] != "" {
+		f.Attr = validateAttrName([]rune(parts[0]))
+	}
+	parts = parts[1:]
+	if len(parts) > 0 && strings.EqualFold(parts[0], "dn") {
+		f.DNAttributes = true
+		parts = parts[1:]
+	}
+	if len(parts) > 0 {
+		f.Rule = validateRuleName(parts[0])
+		parts = parts[1:]
 	}
-	for i, r := range rs {
-		if !isValidAttrRune(i, r) {
-			panicf("%w: invalid char %q", ErrInvalidAttrName, r)
+	if len(parts) > 0 {
+		panicf("%w: %s", ErrUnexpectedInput, strings.Join(parts, ":"))
+	}
+	if f.Attr == "" && f.Rule == "" {
+		panice(ErrMissingRule)
+	}
+	if mr := LookupMatchingRule(f.Rule); mr != nil && mr.Usage == SubstringsRule {
+		// The value is a substring assertion, where only unescaped stars
+		// separate the substrings. Stars that were escaped in the filter
+		// are escaped again in the assertion.
+		f.Value = encodeSubstringAssertion(decodeValue(value, true))
+	} else {
+		f.Value = decodeValue(value, false)[0]
+	}
+	return f
+}
+
+// validateRuleName validates that a matching rule name is either a descriptor
+// (a letter followed by letters, digits and hyphens) or a numeric OID.
+func validateRuleName(rule string) string {
+	if !isDescr(rule) && !isNumericOID(rule) {
+		panicf("%w: %q", ErrInvalidRule, rule)
+	}
+	return rule
+}
+
+func isDescr(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && (i == 0 || (r != '-' && !unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isKeychars(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+			return false
 		}
 	}
-	return string(rs)
+	return s != ""
 }
 
-func isValidAttrRune(pos int, r rune) bool {
-	if pos == 0 {
-		return unicode.IsLetter(r)
+func isNumericOID(s string) bool {
+	for _, num := range strings.Split(s, ".") {
+		if num == "" || strings.TrimLeft(num, "0123456789") != "" || (len(num) > 1 && num[0] == '0') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateAttrName validates that rs is an attribute description as described
+// in [RFC 4512, section 2.5] - an attribute type as either a descriptor or a
+// numeric OID, followed by zero or more options each preceded by a semicolon.
+// Options consist of letters, digits and hyphens. e.g. `cn`, `2.5.4.3` or
+// `cn;lang-en`.
+//
+// [RFC 4512, section 2.5]: https://datatracker.ietf.org/doc/html/rfc4512#section-2.5
+func validateAttrName(rs []rune) string {
+	if len(rs) == 0 {
+		panice(ErrEmptyAttrName)
+	}
+	attr := string(rs)
+	attrType, options, hasOptions := strings.Cut(attr, ";")
+	if !isDescr(attrType) && !isNumericOID(attrType) {
+		panicf("%w: %q", ErrInvalidAttrName, attrType)
+	}
+	if !hasOptions {
+		return attr
+	}
+	for _, option := range strings.Split(options, ";") {
+		if !isKeychars(option) {
+			panicf("%w: invalid option %q", ErrInvalidAttrName, option)
+		}
 	}
-	return r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	return attr
 }
 
 func isOp(op string) bool {
@@ -195,6 +358,128 @@ func (f *Equality) Match(e *Entry) bool {
 	return ok && attr.HasValue(f.Value)
 }
 
+// Substring is a FilterNode for a substring filter - a filter that matches an
+// entry if the entry has an attribute of the given name with a value that
+// starts with Initial, contains each of Any in order and ends with Final. None
+// of the components overlap in the value. Initial and Final may be empty and
+// Any may have no elements. Its syntax is `(attr=[initial]*[any]*...*[final])`.
+type Substring struct {
+	Attr    string
+	Initial string
+	Any     []string
+	Final   string
+}
+
+// Match implements the Match method of the [FilterNode] interface.
+func (f *Substring) Match(e *Entry) bool {
+	attr, ok := e.GetAttr(f.Attr)
+	return ok && attr.HasSubstring(f.Initial, f.Any, f.Final)
+}
+
+// GreaterOrEqual is a FilterNode for a greater-or-equal filter - a filter that
+// matches an entry if the entry has an attribute of the given name with a value
+// that orders after or the same as the given value. Values are ordered as
+// described by [Attr.CompareValues]. Its syntax is `(attr>=<value>)`.
+type GreaterOrEqual struct {
+	Attr  string
+	Value string
+}
+
+// Match implements the Match method of the [FilterNode] interface.
+func (f *GreaterOrEqual) Match(e *Entry) bool {
+	attr, ok := e.GetAttr(f.Attr)
+	return ok && attr.hasOrderedValue(f.Value, func(c int) bool { return c >= 0 })
+}
+
+// LessOrEqual is a FilterNode for a less-or-equal filter - a filter that
+// matches an entry if the entry has an attribute of the given name with a value
+// that orders before or the same as the given value. Values are ordered as
+// described by [Attr.CompareValues]. Its syntax is `(attr<=<value>)`.
+type LessOrEqual struct {
+	Attr  string
+	Value string
+}
+
+// Match implements the Match method of the [FilterNode] interface.
+func (f *LessOrEqual) Match(e *Entry) bool {
+	attr, ok := e.GetAttr(f.Attr)
+	return ok && attr.hasOrderedValue(f.Value, func(c int) bool { return c <= 0 })
+}
+
+// Approx is a FilterNode for an approximate match filter - a filter that
+// matches an entry if the entry has an attribute of the given name with a
+// value that sounds like the given value. Values are approximately matched as
+// described by [Attr.HasApproxValue]. Its syntax is `(attr~=<value>)`.
+type Approx struct {
+	Attr  string
+	Value string
+}
+
+// Match implements the Match method of the [FilterNode] interface.
+func (f *Approx) Match(e *Entry) bool {
+	attr, ok := e.GetAttr(f.Attr)
+	return ok && attr.HasApproxValue(f.Value)
+}
+
+// ExtensibleMatch is a FilterNode for an extensible match filter - a filter
+// that matches an entry using a specific matching rule (see [MatchingRule]).
+// Its syntax is `(attr[:dn][:rule]:=<value>)`, where at least one of attr or
+// rule must be present.
+//
+// If Attr is set, the filter matches if a value of that attribute matches
+// Value using Rule, or the attribute's equality matching if Rule is not set.
+// If Attr is not set, all of the entry's attributes are matched using Rule.
+// If DNAttributes is true, the attribute values in the RDNs of the entry's
+// DN are also matched. A Rule that is not known does not match any entry.
+type ExtensibleMatch struct {
+	Attr         string
+	Rule         string
+	DNAttributes bool
+	Value        string
+}
+
+// Match implements the Match method of the [FilterNode] interface.
+func (f *ExtensibleMatch) Match(e *Entry) bool {
+	var rule *MatchingRule
+	if f.Rule != "" {
+		if rule = LookupMatchingRule(f.Rule); rule == nil {
+			return false
+		}
+	}
+	match := func(attr Attr) bool {
+		if rule == nil {
+			return attr.HasValue(f.Value)
+		}
+		return slices.ContainsFunc(attr.Vals, func(v string) bool { return rule.Match(v, f.Value) })
+	}
+
+	if f.Attr != "" {
+		if attr, ok := e.GetAttr(f.Attr); ok && match(attr) {
+			return true
+		}
+	} else {
+		for _, attr := range e.Attrs {
+			if match(attr) {
+				return true
+			}
+		}
+	}
+
+	if f.DNAttributes {
+		for _, rdn := range e.DN {
+			for _, ava := range rdn {
+				if f.Attr != "" && schema.attrKey(f.Attr) != schema.attrKey(ava.Name) {
+					continue
+				}
+				if match(Attr{Name: ava.Name, Vals: []string{ava.Value}}) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // And is a FilterNode for an AND filter - a filter that matches if all its
 // child FilterNodes match. It can have zero or more child nodes. If it has
 // zero child nodes, it will match any entry. Its syntax is
@@ -274,10 +559,16 @@ func (c *cursor) peek() rune {
 	return c.input[c.pos]
 }
 
-func (c *cursor) extractTo(r rune) []rune {
+// extractItem extracts the contents of a filter item up to the closing
+// parenthesis. A parenthesis escaped with a backslash does not close the item.
+func (c *cursor) extractItem() []rune {
 	start := c.pos
-	for ; !c.isEOF() && c.input[c.pos] != r; c.pos++ {
+	for ; !c.isEOF() && c.input[c.pos] != ')'; c.pos++ {
+		if c.input[c.pos] == '\\' {
+			c.pos++
+		}
 	}
+	c.pos = min(c.pos, len(c.input))
 	return c.input[start:c.pos]
 }
 
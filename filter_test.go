@@ -38,6 +38,126 @@ func Test_FilterParse(t *testing.T) {
 			filter:       "(eq=eqval)",
 			expectedNode: equality,
 		},
+		{
+			name:         "substring initial",
+			filter:       "(sub=jo*)",
+			expectedNode: &Substring{Attr: "sub", Initial: "jo"},
+		},
+		{
+			name:         "substring final",
+			filter:       "(sub=*son)",
+			expectedNode: &Substring{Attr: "sub", Final: "son"},
+		},
+		{
+			name:         "substring any",
+			filter:       "(sub=*mit*)",
+			expectedNode: &Substring{Attr: "sub", Any: []string{"mit"}},
+		},
+		{
+			name:         "substring all",
+			filter:       "(sub=a*b**c*d)",
+			expectedNode: &Substring{Attr: "sub", Initial: "a", Any: []string{"b", "c"}, Final: "d"},
+		},
+		{
+			name:         "greater or equal",
+			filter:       "(ge>=geval)",
+			expectedNode: &GreaterOrEqual{Attr: "ge", Value: "geval"},
+		},
+		{
+			name:         "less or equal",
+			filter:       "(le<=leval)",
+			expectedNode: &LessOrEqual{Attr: "le", Value: "leval"},
+		},
+		{
+			name:         "approx",
+			filter:       "(ap~=apval)",
+			expectedNode: &Approx{Attr: "ap", Value: "apval"},
+		},
+		{
+			name:         "extensible attr",
+			filter:       "(ext:=extval)",
+			expectedNode: &ExtensibleMatch{Attr: "ext", Value: "extval"},
+		},
+		{
+			name:         "extensible dn",
+			filter:       "(ext:dn:=extval)",
+			expectedNode: &ExtensibleMatch{Attr: "ext", DNAttributes: true, Value: "extval"},
+		},
+		{
+			name:         "extensible rule",
+			filter:       "(ext:caseExactMatch:=extval)",
+			expectedNode: &ExtensibleMatch{Attr: "ext", Rule: "caseExactMatch", Value: "extval"},
+		},
+		{
+			name:         "extensible dn rule",
+			filter:       "(ext:DN:2.5.13.5:=extval)",
+			expectedNode: &ExtensibleMatch{Attr: "ext", Rule: "2.5.13.5", DNAttributes: true, Value: "extval"},
+		},
+		{
+			name:         "extensible no attr",
+			filter:       "(:dn:caseIgnoreMatch:=extval)",
+			expectedNode: &ExtensibleMatch{Rule: "caseIgnoreMatch", DNAttributes: true, Value: "extval"},
+		},
+		{
+			name:         "escaped paren",
+			filter:       `(eq=a\29b\28)`,
+			expectedNode: &Equality{Attr: "eq", Value: "a)b("},
+		},
+		{
+			name:         "escaped star",
+			filter:       `(eq=\2a)`,
+			expectedNode: &Equality{Attr: "eq", Value: "*"},
+		},
+		{
+			name:         "escaped backslash and nul",
+			filter:       `(eq=\5C\00)`,
+			expectedNode: &Equality{Attr: "eq", Value: "\\\x00"},
+		},
+		{
+			name:         "escaped utf-8",
+			filter:       `(eq=Lu\c4\8di\c4\87)`,
+			expectedNode: &Equality{Attr: "eq", Value: "Lučić"},
+		},
+		{
+			name:         "rfc 1960 escapes",
+			filter:       `(eq=\(a\*b\)\\)`,
+			expectedNode: &Equality{Attr: "eq", Value: "(a*b)\\"},
+		},
+		{
+			name:         "escaped substring",
+			filter:       `(sub=\2a*\2a*\2A)`,
+			expectedNode: &Substring{Attr: "sub", Initial: "*", Any: []string{"*"}, Final: "*"},
+		},
+		{
+			name:         "escaped ordering",
+			filter:       `(ge>=\2a*)`,
+			expectedNode: &GreaterOrEqual{Attr: "ge", Value: "**"},
+		},
+		{
+			name:         "escaped extensible",
+			filter:       `(ext:dn:=a\3a\3db)`,
+			expectedNode: &ExtensibleMatch{Attr: "ext", DNAttributes: true, Value: "a:=b"},
+		},
+		{
+			name:         "escaped extensible substrings",
+			filter:       `(ext:caseIgnoreSubstringsMatch:=a\2ab*c\5cd*)`,
+			expectedNode: &ExtensibleMatch{Attr: "ext", Rule: "caseIgnoreSubstringsMatch", Value: `a\2Ab*c\5Cd*`},
+		},
+		{
+			name:         "attribute options",
+			filter:       "(cn;lang-en;x-1=eqval)",
+			expectedNode: &Equality{Attr: "cn;lang-en;x-1", Value: "eqval"},
+		},
+		{
+			name:         "numeric oid",
+			filter:       "(2.5.4.3=eqval)",
+			expectedNode: &Equality{Attr: "2.5.4.3", Value: "eqval"},
+		},
+		{
+			name:         "numeric oid extensible",
+			filter:       "(2.5.4.3;binary:2.5.13.5:=extval)",
+			expectedNode: &ExtensibleMatch{Attr: "2.5.4.3;binary", Rule: "2.5.13.5", Value: "extval"},
+		},
 		{
 			name:         "and one",
 			filter:       "(&(eq=eqval))",
@@ -138,45 +258,79 @@ func Test_FilterParse_Fail(t *testing.T) {
 			err:    ErrUnexpectedInput,
 		},
 		{
-			name:   "no subfilters",
-			filter: "(&)",
+			name:   "extensible no attr or rule",
+			filter: "(:dn:=value)",
+			err:    ErrMissingRule,
+		},
+		{
+			name:   "extensible empty rule",
+			filter: "(attr::=value)",
+			err:    ErrInvalidRule,
+		},
+		{
+			name:   "extensible invalid rule",
+			filter: "(attr:1.2.:=value)",
+			err:    ErrInvalidRule,
+		},
+		{
+			name:   "extensible invalid attribute",
+			filter: "(attr$:dn:=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "extensible extra component",
+			filter: "(attr:dn:caseIgnoreMatch:x:=value)",
 			err:    ErrUnexpectedInput,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) { testfunc(t, tt) })
-	}
-}
-
-func Test_FilterParse_Unimplemented(t *testing.T) {
-	type testcase struct {
-		name   string
-		filter string
-		err    error
-	}
-
-	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
-		is := is.New(t)
-		_, err := Parse(tt.filter)
-		is.True(errors.Is(err, tt.err))
-	}
-
-	tests := []testcase{
 		{
-			name:   "less than or equal",
-			filter: "(attr<=value)",
-			err:    ErrUnimplemented,
+			name:   "extensible empty value",
+			filter: "(attr:dn:=)",
+			err:    ErrEmptyAttrValue,
+		},
+		{
+			name:   "invalid escape",
+			filter: `(attr=\zz)`,
+			err:    ErrInvalidEscape,
 		},
 		{
-			name:   "greater than or equal",
-			filter: "(attr>=value)",
-			err:    ErrUnimplemented,
+			name:   "short escape",
+			filter: `(attr=a\2)`,
+			err:    ErrInvalidEscape,
 		},
 		{
-			name:   "tilde equal",
-			filter: "(attr~=value)",
-			err:    ErrUnimplemented,
+			name:   "escaped close paren",
+			filter: `(attr=a\)`,
+			err:    ErrUnexpectedEOF,
+		},
+		{
+			name:   "empty option",
+			filter: "(attr;=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "invalid option",
+			filter: "(attr;lang_en=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "invalid numeric oid",
+			filter: "(2.5..3=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "leading zero numeric oid",
+			filter: "(2.05.3=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "invalid descriptor",
+			filter: "(attr.name=value)",
+			err:    ErrInvalidAttrName,
+		},
+		{
+			name:   "no subfilters",
+			filter: "(&)",
+			err:    ErrUnexpectedInput,
 		},
 	}
 
@@ -198,6 +352,8 @@ func Test_FilterMatch(t *testing.T) {
 			"dn":          "dc=example,dc=com",
 			"objectClass": "top",
 			"uid":         "1234",
+			"gecos":       "John Smith",
+			"uidNumber":   10000.0,
 		}
 		e, err := NewEntryFromMap(attrs)
 		is.NoErr(err)
@@ -234,6 +390,216 @@ func Test_FilterMatch(t *testing.T) {
 			filter: "(cn=username)",
 			want:   false,
 		},
+		{
+			name:   "substring initial",
+			filter: "(gecos=jo*)",
+			want:   true,
+		},
+		{
+			name:   "substring final",
+			filter: "(gecos=*SMITH)",
+			want:   true,
+		},
+		{
+			name:   "substring any",
+			filter: "(gecos=*n s*)",
+			want:   true,
+		},
+		{
+			name:   "substring all",
+			filter: "(gecos=j*h*s*h)",
+			want:   true,
+		},
+		{
+			name:   "substring no match",
+			filter: "(gecos=*smithy)",
+			want:   false,
+		},
+		{
+			name:   "substring no overlap",
+			filter: "(gecos=john*n smith)",
+			want:   false,
+		},
+		{
+			name:   "substring out of order",
+			filter: "(gecos=*smith*john*)",
+			want:   false,
+		},
+		{
+			name:   "substring not present",
+			filter: "(sn=s*)",
+			want:   false,
+		},
+		{
+			name:   "greater or equal numeric",
+			filter: "(uidNumber>=9999)",
+			want:   true,
+		},
+		{
+			name:   "greater or equal numeric equal",
+			filter: "(uidNumber>=10000)",
+			want:   true,
+		},
+		{
+			name:   "greater or equal numeric false",
+			filter: "(uidNumber>=10001)",
+			want:   false,
+		},
+		{
+			name:   "less or equal numeric",
+			filter: "(uidNumber<=10000)",
+			want:   true,
+		},
+		{
+			name:   "less or equal numeric false",
+			filter: "(uidNumber<=9999)",
+			want:   false,
+		},
+		{
+			name:   "less or equal non-integer",
+			filter: "(uidNumber<=abc)",
+			want:   false,
+		},
+		{
+			name:   "greater or equal lexical",
+			filter: "(gecos>=JOHN)",
+			want:   true,
+		},
+		{
+			name:   "greater or equal lexical false",
+			filter: "(gecos>=kate)",
+			want:   false,
+		},
+		{
+			name:   "less or equal lexical",
+			filter: "(gecos<=john smith)",
+			want:   true,
+		},
+		{
+			name:   "less or equal lexical false",
+			filter: "(uid<=1000)",
+			want:   false,
+		},
+		{
+			name:   "greater or equal not present",
+			filter: "(cn>=a)",
+			want:   false,
+		},
+		{
+			name:   "approx",
+			filter: "(gecos~=jon  SMYTH)",
+			want:   true,
+		},
+		{
+			name:   "approx exact",
+			filter: "(gecos~=John Smith)",
+			want:   true,
+		},
+		{
+			name:   "approx word count",
+			filter: "(gecos~=John)",
+			want:   false,
+		},
+		{
+			name:   "approx false",
+			filter: "(gecos~=Jack Smith)",
+			want:   false,
+		},
+		{
+			name:   "approx non-letters",
+			filter: "(uid~=1234)",
+			want:   true,
+		},
+		{
+			name:   "approx non-letters false",
+			filter: "(uid~=1243)",
+			want:   false,
+		},
+		{
+			name:   "extensible equality",
+			filter: "(gecos:=JOHN SMITH)",
+			want:   true,
+		},
+		{
+			name:   "extensible not in attrs",
+			filter: "(dc:=example)",
+			want:   false,
+		},
+		{
+			name:   "extensible dn",
+			filter: "(dc:dn:=EXAMPLE)",
+			want:   true,
+		},
+		{
+			name:   "extensible dn rule",
+			filter: "(dc:dn:caseExactMatch:=example)",
+			want:   true,
+		},
+		{
+			name:   "extensible dn rule false",
+			filter: "(dc:dn:caseExactMatch:=Example)",
+			want:   false,
+		},
+		{
+			name:   "extensible dn any attribute",
+			filter: "(:dn:caseIgnoreMatch:=COM)",
+			want:   true,
+		},
+		{
+			name:   "extensible case exact",
+			filter: "(gecos:caseExactMatch:=John Smith)",
+			want:   true,
+		},
+		{
+			name:   "extensible case exact false",
+			filter: "(gecos:caseExactMatch:=john smith)",
+			want:   false,
+		},
+		{
+			name:   "extensible case ignore oid",
+			filter: "(gecos:2.5.13.2:=john  smith)",
+			want:   true,
+		},
+		{
+			name:   "extensible any attribute",
+			filter: "(:caseIgnoreMatch:=JOHN SMITH)",
+			want:   true,
+		},
+		{
+			name:   "extensible any attribute false",
+			filter: "(:caseIgnoreMatch:=example)",
+			want:   false,
+		},
+		{
+			name:   "extensible integer",
+			filter: "(uidNumber:integerMatch:=010000)",
+			want:   true,
+		},
+		{
+			name:   "extensible integer ordering",
+			filter: "(uidNumber:integerOrderingMatch:=10001)",
+			want:   true,
+		},
+		{
+			name:   "extensible integer ordering false",
+			filter: "(uidNumber:integerOrderingMatch:=10000)",
+			want:   false,
+		},
+		{
+			name:   "extensible substrings",
+			filter: "(gecos:caseExactSubstringsMatch:=J*Smi*)",
+			want:   true,
+		},
+		{
+			name:   "extensible substrings escaped star",
+			filter: `(gecos:caseExactSubstringsMatch:=J\2a)`,
+			want:   false,
+		},
+		{
+			name:   "extensible unknown rule",
+			filter: "(gecos:unknownMatch:=John Smith)",
+			want:   false,
+		},
 		{
 			name:   "and true",
 			filter: "(&(objectClass=*)(uid=1234))",
@@ -5,6 +5,8 @@ go 1.24.1
 require (
 	foxygo.at/jsonnext v0.1.16
 	github.com/alecthomas/kong v1.9.0
+	github.com/go-asn1-ber/asn1-ber v1.5.7
+	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/jimlambrt/gldap v0.1.14
 	github.com/matryer/is v1.4.1
 )
@@ -14,8 +16,6 @@ require (
 	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/color v1.17.0 // indirect
-	github.com/go-asn1-ber/asn1-ber v1.5.7 // indirect
-	github.com/go-ldap/ldap/v3 v3.4.8 // indirect
 	github.com/google/go-jsonnet v0.17.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/go-hclog v1.6.3 // indirect
@@ -28,3 +28,6 @@ require (
 	golang.org/x/sys v0.24.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// gldap is patched to decode more request types. See third_party/gldap.
+replace github.com/jimlambrt/gldap => ./third_party/gldap
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"os"
+	"path/filepath"
 )
 
 // ReadJSON parses JSON from an [io.Reader] and returns a slice of the entries
@@ -51,6 +53,33 @@ func ReadJSON(r io.Reader) ([]*Entry, error) {
 	return entries, nil
 }
 
+// ReadJSONDir reads the entries from each file in dir with a ".json"
+// extension, in the order of their names, with [ReadJSON]. The entries are
+// given the origin [OriginFiles].
+func ReadJSONDir(dir string) ([]*Entry, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list entries files: %w", err)
+	}
+	var entries []*Entry
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("could not read entries file: %w", err)
+		}
+		fileEntries, err := ReadJSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	for _, e := range entries {
+		e.Origin = OriginFiles
+	}
+	return entries, nil
+}
+
 func getEntries(a any) ([]*Entry, error) {
 	var entries []*Entry
 	switch v := a.(type) {
@@ -73,3 +102,15 @@ func getEntries(a any) ([]*Entry, error) {
 	}
 	return entries, nil
 }
+
+// MarshalJSON returns e as a JSON object of the form read by [ReadJSON]: the
+// DN as the "dn" field and each attribute as a field whose value is an array
+// of the attribute's values.
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]any, len(e.Attrs)+1)
+	obj["dn"] = e.DN.String()
+	for _, a := range e.Attrs {
+		obj[a.Name] = a.Vals
+	}
+	return json.Marshal(obj)
+}
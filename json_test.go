@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"slices"
 	"testing"
 
@@ -57,3 +58,23 @@ func Test_ReadJSON_Failure(t *testing.T) {
 		t.Run(filename, func(t *testing.T) { testfn(t, filename) })
 	}
 }
+
+func Test_ReadJSONDir(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"dn": "uid=b,dc=example,dc=com", "objectClass": "account"}]`), 0o600))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"a": {"dn": "uid=a,dc=example,dc=com", "objectClass": "account"}}`), 0o600))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "c.txt"), []byte(`not json`), 0o600))
+
+	entries, err := ReadJSONDir(dir)
+	is.NoErr(err)
+	is.Equal(2, len(entries))
+	is.Equal(MustDN(t, "uid=a,dc=example,dc=com"), entries[0].DN)
+	is.Equal(MustDN(t, "uid=b,dc=example,dc=com"), entries[1].DN)
+	is.Equal(OriginFiles, entries[0].Origin)
+	is.Equal(OriginFiles, entries[1].Origin)
+
+	is.NoErr(os.WriteFile(filepath.Join(dir, "d.json"), []byte(`[{"dn": "uid=d,dc=example,dc=com"}]`), 0o600))
+	_, err = ReadJSONDir(dir)
+	is.True(err != nil)
+}
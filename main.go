@@ -1,5 +1,5 @@
 // Command flapjak is a very lightweight (featherweight) LDAP server that
-// serves static records read-only.
+// serves static records, read-only unless writers are given.
 //
 //	Usage: flapjak --entries=STRING [flags]
 //
@@ -8,6 +8,9 @@
 //	Flags:
 //	  -h, --help                   Show context-sensitive help.
 //	      --entries=STRING         Name of jsonnet file containing LDAP entries
+//	      --entries-dir=DIR        Directory of JSON files containing more LDAP
+//	                               entries, which static entries take precedence
+//	                               over
 //	  -J, --jpath=dir              Add a library search dir
 //	      --max-stack=500          Number of allowed stack frames of jsonnet VM
 //	      --max-trace=20           Maximum number of stack frames output on error
@@ -28,11 +31,42 @@
 //	      --tla-code-file=var[=filename]
 //	                               Set top-level arg code from a file (filename from
 //	                               env if omitted)
-//	      --listen=":10389"        Listen address
+//	      --schema=FILE,...        OpenLDAP schema file (.schema or cn=config .ldif)
+//	                               to load
+//	      --[no-]validate          Validate entries against the schema
+//	      --rdn-attrs="ignore"     How to handle entries without their RDN attribute
+//	                               values: add the values, reject the entries or
+//	                               ignore them (ignore,add,reject)
+//	      --orphans="allow"        How to handle entries whose parent does not
+//	                               exist: allow them, reject them or create their
+//	                               parents (allow,reject,create)
+//	      --writer=DN,...          DN of an entry that may add, modify and delete
+//	                               entries when bound
+//	      --data-dir=DIR           Directory to store changes made by writers in,
+//	                               to apply again on restart
+//	      --listen=":10389"        Listen address, or empty to not serve LDAP
+//	                               without TLS
+//	      --ldaps-listen=ADDR      Listen address for LDAPS, which requires
+//	                               --tls-cert and --tls-key
+//	      --tls-cert=FILE          PEM file of the TLS certificate chain, reloaded
+//	                               when it changes
+//	      --tls-key=FILE           PEM file of the TLS private key, reloaded when it
+//	                               changes
+//	      --require-tls            Reject binds on connections without TLS, until
+//	                               StartTLS
+//	      --tls-client-ca=FILE     PEM file of the CA certificates of TLS client
+//	                               certificates, to bind with SASL EXTERNAL
+//	      --tls-client-dn="{subject}"
+//	                               DN of the entry that a TLS client certificate
+//	                               binds as, with {subject}, {cn}, {email} and
+//	                               {dns} replaced from the certificate
 //	      --version                Print program version
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -48,10 +82,35 @@ flapjak is a simple server of static LDAP records.
 `
 
 type CLI struct {
-	Entries string           `required:"" help:"Name of jsonnet file containing LDAP entries"`
-	Jnx     jnxkong.Config   `embed:""`
-	Listen  string           `default:":10389" help:"Listen address"`
-	Version kong.VersionFlag `help:"Print program version"`
+	Entries     string           `required:"" help:"Name of jsonnet file containing LDAP entries"`
+	EntriesDir  string           `type:"existingdir" placeholder:"DIR" help:"Directory of JSON files containing more LDAP entries, which static entries take precedence over"`
+	Jnx         jnxkong.Config   `embed:""`
+	Schema      []string         `type:"existingfile" placeholder:"FILE" help:"OpenLDAP schema file (.schema or cn=config .ldif) to load"`
+	Validate    bool             `default:"true" negatable:"" help:"Validate entries against the schema"`
+	RDNAttrs    string           `name:"rdn-attrs" enum:"ignore,add,reject" default:"ignore" help:"How to handle entries without their RDN attribute values: add the values, reject the entries or ignore them (${enum})"`
+	Orphans     string           `enum:"allow,reject,create" default:"allow" help:"How to handle entries whose parent does not exist: allow them, reject them or create their parents (${enum})"`
+	Writers     []string         `name:"writer" placeholder:"DN" help:"DN of an entry that may add, modify and delete entries when bound"`
+	DataDir     string           `type:"path" placeholder:"DIR" help:"Directory to store changes made by writers in, to apply again on restart"`
+	Listen      string           `default:":10389" help:"Listen address, or empty to not serve LDAP without TLS"`
+	LDAPSListen string           `name:"ldaps-listen" placeholder:"ADDR" help:"Listen address for LDAPS, which requires --tls-cert and --tls-key"`
+	TLSCert     string           `type:"existingfile" placeholder:"FILE" help:"PEM file of the TLS certificate chain, reloaded when it changes"`
+	TLSKey      string           `type:"existingfile" placeholder:"FILE" help:"PEM file of the TLS private key, reloaded when it changes"`
+	RequireTLS  bool             `name:"require-tls" help:"Reject binds on connections without TLS, until StartTLS"`
+	TLSClientCA string           `name:"tls-client-ca" type:"existingfile" placeholder:"FILE" help:"PEM file of the CA certificates of TLS client certificates, to bind with SASL EXTERNAL"`
+	TLSClientDN string           `name:"tls-client-dn" default:"{subject}" help:"DN of the entry that a TLS client certificate binds as, with {subject}, {cn}, {email} and {dns} replaced from the certificate"`
+	Version     kong.VersionFlag `help:"Print program version"`
+}
+
+var rdnAttrsModes = map[string]RDNAttrsMode{
+	"ignore": RDNAttrsIgnore,
+	"add":    RDNAttrsAdd,
+	"reject": RDNAttrsReject,
+}
+
+var orphansModes = map[string]OrphansMode{
+	"allow":  OrphansAllow,
+	"reject": OrphansReject,
+	"create": OrphansCreate,
 }
 
 func main() {
@@ -67,6 +126,13 @@ func main() {
 }
 
 func (cli *CLI) Run() error {
+	for _, filename := range cli.Schema {
+		slog.Info("Loading schema", "filename", filename)
+		if err := schema.LoadFile(filename); err != nil {
+			return fmt.Errorf("could not load schema: %w", err)
+		}
+	}
+
 	vm := cli.Jnx.MakeVM("FLAPJAK_PATH")
 	jsonEntries, err := vm.EvaluateFile(cli.Entries)
 	if err != nil {
@@ -77,17 +143,74 @@ func (cli *CLI) Run() error {
 	if err != nil {
 		return fmt.Errorf("could not load entries: %w", err)
 	}
+	if cli.EntriesDir != "" {
+		slog.Info("Loading entries", "dir", cli.EntriesDir)
+		dirEntries, err := ReadJSONDir(cli.EntriesDir)
+		if err != nil {
+			return fmt.Errorf("could not load entries: %w", err)
+		}
+		entries = append(entries, dirEntries...)
+	}
 
 	db := NewDB()
+	db.ValidateEntries = cli.Validate
+	db.RDNAttrs = rdnAttrsModes[cli.RDNAttrs]
+	db.Orphans = orphansModes[cli.Orphans]
 	if err := db.AddEntries(entries); err != nil {
 		return fmt.Errorf("could not add entries to db: %w", err)
 	}
 
 	slog.Info("Entries loaded", "count", len(entries))
 
-	s, err := NewServer(db)
-	if err != nil {
-		return err
+	if cli.DataDir != "" {
+		store, err := NewFileStore(cli.DataDir)
+		if err != nil {
+			return err
+		}
+		defer store.Close() //nolint:errcheck // nothing left to save
+		db.Store = store
+		if err := db.LoadStore(); err != nil {
+			return fmt.Errorf("could not apply stored changes: %w", err)
+		}
+		slog.Info("Stored changes applied", "dir", cli.DataDir)
+	}
+
+	s := NewServer(db)
+	if (cli.TLSCert == "") != (cli.TLSKey == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if cli.TLSCert != "" {
+		cert, err := NewTLSCertificate(cli.TLSCert, cli.TLSKey)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go cert.Watch(ctx, TLSReloadInterval)
+		s.TLSConfig = NewTLSConfig(cert)
+	}
+	if cli.RequireTLS && s.TLSConfig == nil {
+		return errors.New("--require-tls requires --tls-cert and --tls-key")
+	}
+	s.RequireTLS = cli.RequireTLS
+	if cli.TLSClientCA != "" {
+		if s.TLSConfig == nil {
+			return errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		if s.TLSConfig.ClientCAs, err = LoadCertPool(cli.TLSClientCA); err != nil {
+			return err
+		}
+		s.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if s.ClientCertMapping, err = NewClientCertMapping(cli.TLSClientDN); err != nil {
+			return err
+		}
+	}
+	for _, w := range cli.Writers {
+		dn, err := NewDN(w)
+		if err != nil {
+			return fmt.Errorf("invalid writer: %w", err)
+		}
+		s.Writers = append(s.Writers, dn)
 	}
-	return s.Run(cli.Listen)
+	return s.Run(cli.Listen, cli.LDAPSListen)
 }
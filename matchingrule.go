@@ -0,0 +1,363 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// MatchingRuleUsage is the type of assertion a [MatchingRule] is used for.
+type MatchingRuleUsage int
+
+const (
+	// EqualityRule is a matching rule that asserts two values are equal.
+	EqualityRule MatchingRuleUsage = iota
+	// OrderingRule is a matching rule that asserts a value is less than
+	// another.
+	OrderingRule
+	// SubstringsRule is a matching rule that asserts a value contains the
+	// substrings of a substrings assertion.
+	SubstringsRule
+)
+
+// MatchingRule is an LDAP matching rule used to compare attribute values with
+// assertion values, as described in [RFC 4517, section 4]. Values are first
+// normalised according to the rule and then compared.
+//
+// [RFC 4517, section 4]: https://datatracker.ietf.org/doc/html/rfc4517#section-4
+type MatchingRule struct {
+	// OID is the numeric object identifier of the matching rule.
+	OID string
+	// Name is the short descriptive name of the matching rule.
+	Name string
+	// Syntax is the OID of the syntax of assertion values of the rule.
+	Syntax string
+	// Usage is the type of assertion the matching rule is for.
+	Usage MatchingRuleUsage
+
+	// normalize returns the normalised form of a value for comparison or
+	// false if the value is not valid for the rule.
+	normalize func(string) (string, bool)
+	// compare compares two normalised values, returning -1, 0 or 1.
+	compare func(string, string) int
+}
+
+// matchingRuleList is the list of supported matching rules.
+var matchingRuleList = []*MatchingRule{
+	{OID: "2.5.13.0", Name: "objectIdentifierMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.38", Usage: EqualityRule, normalize: foldCase},
+	{OID: "2.5.13.1", Name: "distinguishedNameMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.12", Usage: EqualityRule},
+	{OID: "2.5.13.2", Name: "caseIgnoreMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.15", Usage: EqualityRule, normalize: foldCase},
+	{OID: "2.5.13.3", Name: "caseIgnoreOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.15", Usage: OrderingRule, normalize: foldCase},
+	{OID: "2.5.13.4", Name: "caseIgnoreSubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: foldCase},
+	{OID: "2.5.13.5", Name: "caseExactMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.15", Usage: EqualityRule, normalize: trimSpace},
+	{OID: "2.5.13.6", Name: "caseExactOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.15", Usage: OrderingRule, normalize: trimSpace},
+	{OID: "2.5.13.7", Name: "caseExactSubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: trimSpace},
+	{OID: "2.5.13.8", Name: "numericStringMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.36", Usage: EqualityRule, normalize: removeSpace},
+	{OID: "2.5.13.9", Name: "numericStringOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.36", Usage: OrderingRule, normalize: removeSpace},
+	{OID: "2.5.13.10", Name: "numericStringSubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: removeSpace},
+	{OID: "2.5.13.11", Name: "caseIgnoreListMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.41", Usage: EqualityRule, normalize: normalizeCaseIgnoreList},
+	{OID: "2.5.13.12", Name: "caseIgnoreListSubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: normalizeCaseIgnoreList},
+	{OID: "2.5.13.13", Name: "booleanMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.7", Usage: EqualityRule, normalize: normalizeBoolean},
+	{OID: "2.5.13.14", Name: "integerMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.27", Usage: EqualityRule, normalize: normalizeInteger, compare: compareInteger},
+	{OID: "2.5.13.15", Name: "integerOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.27", Usage: OrderingRule, normalize: normalizeInteger, compare: compareInteger},
+	{OID: "2.5.13.16", Name: "bitStringMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.6", Usage: EqualityRule, normalize: removeSpace},
+	{OID: "2.5.13.17", Name: "octetStringMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.40", Usage: EqualityRule, normalize: identity},
+	{OID: "2.5.13.18", Name: "octetStringOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.40", Usage: OrderingRule, normalize: identity},
+	{OID: "2.5.13.20", Name: "telephoneNumberMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.50", Usage: EqualityRule, normalize: normalizeTelephoneNumber},
+	{OID: "2.5.13.21", Name: "telephoneNumberSubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: normalizeTelephoneNumber},
+	{OID: "2.5.13.23", Name: "uniqueMemberMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.34", Usage: EqualityRule},
+	{OID: "2.5.13.27", Name: "generalizedTimeMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.24", Usage: EqualityRule, normalize: normalizeGeneralizedTime},
+	{OID: "2.5.13.28", Name: "generalizedTimeOrderingMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.24", Usage: OrderingRule, normalize: normalizeGeneralizedTime},
+	{OID: "2.5.13.30", Name: "objectIdentifierFirstComponentMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.38", Usage: EqualityRule, normalize: normalizeFirstComponent},
+	{OID: "1.3.6.1.4.1.1466.109.114.1", Name: "caseExactIA5Match", Syntax: "1.3.6.1.4.1.1466.115.121.1.26", Usage: EqualityRule, normalize: trimSpace},
+	{OID: "1.3.6.1.4.1.1466.109.114.2", Name: "caseIgnoreIA5Match", Syntax: "1.3.6.1.4.1.1466.115.121.1.26", Usage: EqualityRule, normalize: foldCase},
+	{OID: "1.3.6.1.4.1.1466.109.114.3", Name: "caseIgnoreIA5SubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: foldCase},
+	{OID: "1.3.6.1.4.1.4203.1.2.1", Name: "caseExactIA5SubstringsMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.58", Usage: SubstringsRule, normalize: trimSpace},
+}
+
+// matchingRules maps the lower-case name and the OID of each supported
+// matching rule to the rule.
+var matchingRules = indexMatchingRules(matchingRuleList)
+
+// The normalisers of the DN matching rules use the schema to normalise the
+// values of each RDN, and the schema refers to matchingRules, so they cannot
+// be set in the initialiser of matchingRules without an initialisation cycle.
+func init() { //nolint:gochecknoinits // breaks the matchingRules <-> schema cycle
+	matchingRules["distinguishednamematch"].normalize = normalizeDN
+	matchingRules["uniquemembermatch"].normalize = normalizeNameAndOptionalUID
+}
+
+func indexMatchingRules(rules []*MatchingRule) map[string]*MatchingRule {
+	index := make(map[string]*MatchingRule, 2*len(rules))
+	for _, mr := range rules {
+		if mr.compare == nil {
+			mr.compare = strings.Compare
+		}
+		index[strings.ToLower(mr.Name)] = mr
+		index[mr.OID] = mr
+	}
+	return index
+}
+
+// LookupMatchingRule returns the matching rule with the given name or OID.
+// Names are case-insensitive. If there is no such matching rule, nil is
+// returned.
+func LookupMatchingRule(nameOrOID string) *MatchingRule {
+	return matchingRules[strings.ToLower(nameOrOID)]
+}
+
+// Normalize returns the normalised form of val according to the matching
+// rule and true, or false if val is not valid for the rule.
+func (mr *MatchingRule) Normalize(val string) (string, bool) {
+	return mr.normalize(val)
+}
+
+// Compare compares v1 and v2 according to the matching rule, returning -1 if
+// v1 orders before v2, 1 if it orders after it and 0 if they are equal. The
+// second return value is false if either value is invalid for the rule and
+// they cannot be compared.
+func (mr *MatchingRule) Compare(v1, v2 string) (int, bool) {
+	n1, ok1 := mr.normalize(v1)
+	n2, ok2 := mr.normalize(v2)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return mr.compare(n1, n2), true
+}
+
+// Match evaluates an assertion of the matching rule against an attribute
+// value, as used by extensible match filters. An equality rule matches if
+// the value equals the assertion value. An ordering rule matches if the value
+// is less than the assertion value. A substrings rule matches if the value
+// matches the substrings assertion `[initial]*[any]*...*[final]`.
+func (mr *MatchingRule) Match(val, assertion string) bool {
+	if mr.Usage == SubstringsRule {
+		return mr.matchSubstrings(val, assertion)
+	}
+	c, ok := mr.Compare(val, assertion)
+	if !ok {
+		return false
+	}
+	if mr.Usage == OrderingRule {
+		return c < 0
+	}
+	return c == 0
+}
+
+// matchSubstrings matches val against a substring assertion in the string
+// form described in [RFC 4517, section 3.3.30]: the substrings separated by
+// '*', with any '*' and '\' in them escaped as \2A and \5C. An assertion
+// without a '*' is invalid and does not match.
+//
+// [RFC 4517, section 3.3.30]: https://datatracker.ietf.org/doc/html/rfc4517#section-3.3.30
+func (mr *MatchingRule) matchSubstrings(val, assertion string) bool {
+	parts := decodeSubstringAssertion(assertion)
+	if len(parts) < 2 {
+		return false
+	}
+	return mr.MatchSubstrings(val, parts[0], parts[1:len(parts)-1], parts[len(parts)-1])
+}
+
+var (
+	substringEscaper   = strings.NewReplacer(`\`, `\5C`, `*`, `\2A`)
+	substringUnescaper = strings.NewReplacer(`\5C`, `\`, `\5c`, `\`, `\2A`, `*`, `\2a`, `*`)
+)
+
+// decodeSubstringAssertion returns the substrings of a substring assertion in
+// the string form matched by matchSubstrings, unescaped.
+func decodeSubstringAssertion(assertion string) []string {
+	parts := strings.Split(assertion, "*")
+	for i, p := range parts {
+		parts[i] = substringUnescaper.Replace(p)
+	}
+	return parts
+}
+
+// encodeSubstringAssertion returns the string form of a substring assertion
+// of the given substrings, as matched by matchSubstrings.
+func encodeSubstringAssertion(parts []string) string {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = substringEscaper.Replace(p)
+	}
+	return strings.Join(escaped, "*")
+}
+
+// MatchSubstrings returns true if val starts with initial, contains each
+// element of anys in order and ends with final, without any of those parts
+// overlapping. The value and each of the parts are normalised according to
+// the matching rule before matching.
+func (mr *MatchingRule) MatchSubstrings(val, initial string, anys []string, final string) bool {
+	v, ok := mr.normalize(val)
+	if !ok {
+		return false
+	}
+	norm := func(s string) string {
+		if s == "" {
+			return s
+		}
+		n, valid := mr.normalize(s)
+		ok = ok && valid
+		return n
+	}
+	initial, final = norm(initial), norm(final)
+	nanys := make([]string, len(anys))
+	for i, sub := range anys {
+		nanys[i] = norm(sub)
+	}
+	return ok && matchSubstring(v, initial, nanys, final)
+}
+
+func matchSubstring(v, initial string, anys []string, final string) bool {
+	if !strings.HasPrefix(v, initial) {
+		return false
+	}
+	v = v[len(initial):]
+	for _, sub := range anys {
+		idx := strings.Index(v, sub)
+		if idx == -1 {
+			return false
+		}
+		v = v[idx+len(sub):]
+	}
+	return strings.HasSuffix(v, final)
+}
+
+func identity(s string) (string, bool) {
+	return s, true
+}
+
+// trimSpace removes leading and trailing space and collapses internal runs
+// of whitespace to a single space, as insignificant space handling of
+// [RFC 4518] does for comparisons.
+//
+// [RFC 4518]: https://datatracker.ietf.org/doc/html/rfc4518#section-2.6.1
+func trimSpace(s string) (string, bool) {
+	return strings.Join(strings.Fields(s), " "), true
+}
+
+func foldCase(s string) (string, bool) {
+	s, _ = trimSpace(s)
+	return strings.ToLower(s), true
+}
+
+func removeSpace(s string) (string, bool) {
+	return strings.Join(strings.Fields(s), ""), true
+}
+
+func normalizeTelephoneNumber(s string) (string, bool) {
+	s, _ = removeSpace(s)
+	return strings.ToLower(strings.ReplaceAll(s, "-", "")), true
+}
+
+func normalizeBoolean(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	return s, s == "TRUE" || s == "FALSE"
+}
+
+func normalizeInteger(s string) (string, bool) {
+	i, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+	if !ok {
+		return "", false
+	}
+	return i.String(), true
+}
+
+func compareInteger(s1, s2 string) int {
+	// Values have been normalised so are known to be valid.
+	i1, _ := new(big.Int).SetString(s1, 10)
+	i2, _ := new(big.Int).SetString(s2, 10)
+	return i1.Cmp(i2)
+}
+
+func normalizeCaseIgnoreList(s string) (string, bool) {
+	lines := strings.Split(s, "$")
+	for i, line := range lines {
+		lines[i], _ = foldCase(line)
+	}
+	return strings.Join(lines, "$"), true
+}
+
+// normalizeGeneralizedTime normalises a GeneralizedTime value, as described in
+// [RFC 4517, section 3.3.13], to UTC with nanosecond precision so that times
+// can be compared as strings.
+//
+// [RFC 4517, section 3.3.13]: https://datatracker.ietf.org/doc/html/rfc4517#section-3.3.13
+func normalizeGeneralizedTime(s string) (string, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	// Fractional hours and minutes are not supported.
+	layouts := []string{"20060102150405.999999999", "200601021504", "2006010215"}
+	for _, layout := range layouts {
+		for _, zone := range []string{"Z0700", "Z07"} {
+			if t, err := time.Parse(layout+zone, s); err == nil {
+				return t.UTC().Format("20060102150405.000000000Z"), true
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeFirstComponent normalises the first component of a value that is a
+// sequence, such as a schema description, or a value that is only a single
+// component, such as an OID used as an assertion value.
+func normalizeFirstComponent(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "("); ok {
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return "", false
+		}
+		s = fields[0]
+	}
+	return strings.ToLower(s), true
+}
+
+// normalizeNameAndOptionalUID normalises a value with the syntax of the
+// uniqueMember attribute - a DN optionally followed by a '#' and a bit string
+// such as '0101'B. A '#' in the DN is escaped or starts a hex value, so the
+// UID is only split off at an unescaped '#' before a bit string at the end.
+func normalizeNameAndOptionalUID(s string) (string, bool) {
+	name, uid := s, ""
+	if i := strings.LastIndex(s, "#'"); i >= 0 && isBitString(strings.TrimSpace(s[i+1:])) && !isEscaped(s, i) {
+		name, uid = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	n, ok := normalizeDN(name)
+	if !ok {
+		return "", false
+	}
+	if uid != "" {
+		n += "#" + uid
+	}
+	return n, true
+}
+
+// isBitString returns whether s is a bit string as described in
+// [RFC 4517, section 3.3.2], e.g. '0101'B.
+//
+// [RFC 4517, section 3.3.2]: https://datatracker.ietf.org/doc/html/rfc4517#section-3.3.2
+func isBitString(s string) bool {
+	bits, ok := strings.CutPrefix(s, "'")
+	if !ok {
+		return false
+	}
+	bits, ok = strings.CutSuffix(bits, "'B")
+	return ok && strings.Trim(bits, "01") == ""
+}
+
+// isEscaped returns whether the character at index i of s is escaped by an
+// odd number of backslashes before it.
+func isEscaped(s string, i int) bool {
+	n := 0
+	for n < i && s[i-n-1] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+func normalizeDN(s string) (string, bool) {
+	dn, err := NewDN(s)
+	if err != nil {
+		return "", false
+	}
+	return dn.Normalize().String(), true
+}
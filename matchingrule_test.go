@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_LookupMatchingRule(t *testing.T) {
+	is := is.New(t)
+
+	mr := LookupMatchingRule("caseIgnoreMatch")
+	is.True(mr != nil)
+	is.Equal("2.5.13.2", mr.OID)
+	is.Equal(mr, LookupMatchingRule("CASEIGNOREMATCH"))
+	is.Equal(mr, LookupMatchingRule("2.5.13.2"))
+	is.Equal(nil, LookupMatchingRule("unknownMatch"))
+}
+
+func Test_MatchingRule_Match(t *testing.T) {
+	type testcase struct {
+		rule      string
+		val       string
+		assertion string
+		want      bool
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		mr := LookupMatchingRule(tt.rule)
+		is.True(mr != nil)
+		is.Equal(tt.want, mr.Match(tt.val, tt.assertion))
+	}
+
+	tests := []testcase{
+		{rule: "caseIgnoreMatch", val: "Foo  Bar", assertion: " foo bar ", want: true},
+		{rule: "caseIgnoreMatch", val: "Foo", assertion: "bar", want: false},
+		{rule: "caseIgnoreOrderingMatch", val: "apple", assertion: "BANANA", want: true},
+		{rule: "caseIgnoreOrderingMatch", val: "banana", assertion: "APPLE", want: false},
+		{rule: "caseIgnoreSubstringsMatch", val: "John Smith", assertion: "JOHN*SMITH", want: true},
+		{rule: "caseIgnoreSubstringsMatch", val: "a*b", assertion: `A\2Ab*`, want: true},
+		{rule: "caseIgnoreSubstringsMatch", val: "axxb", assertion: `a\2ab*`, want: false},
+		{rule: "caseIgnoreSubstringsMatch", val: `a\b`, assertion: `a\5cb*`, want: true},
+		{rule: "caseExactMatch", val: "Foo", assertion: "Foo", want: true},
+		{rule: "caseExactMatch", val: "Foo", assertion: "foo", want: false},
+		{rule: "caseExactOrderingMatch", val: "Zoo", assertion: "apple", want: true},
+		{rule: "caseExactSubstringsMatch", val: "John Smith", assertion: "john*", want: false},
+		{rule: "numericStringMatch", val: "123 456", assertion: "123456", want: true},
+		{rule: "booleanMatch", val: "true", assertion: "TRUE", want: true},
+		{rule: "booleanMatch", val: "yes", assertion: "yes", want: false},
+		{rule: "integerMatch", val: "0042", assertion: "42", want: true},
+		{rule: "integerMatch", val: "42", assertion: "forty-two", want: false},
+		{rule: "integerOrderingMatch", val: "9", assertion: "10", want: true},
+		{rule: "integerOrderingMatch", val: "-10", assertion: "-11", want: false},
+		{rule: "octetStringMatch", val: "a b", assertion: "a  b", want: false},
+		{rule: "telephoneNumberMatch", val: "+61 2 5555-1234", assertion: "+61255551234", want: true},
+		{rule: "distinguishedNameMatch", val: "DC=example,dc=com", assertion: "dc=example, dc=com", want: true},
+		{rule: "distinguishedNameMatch", val: "dc=example,dc=com", assertion: "not a dn", want: false},
+		{rule: "distinguishedNameMatch", val: "cn=A+uid=b,dc=com", assertion: "UID=b+cn=a,dc=com", want: true},
+		{rule: "caseIgnoreIA5Match", val: "User@Example.com", assertion: "user@example.com", want: true},
+		{rule: "uniqueMemberMatch", val: "cn=a,dc=x#'0101'B", assertion: "CN=A, DC=X#'0101'B", want: true},
+		{rule: "uniqueMemberMatch", val: "cn=a,dc=x#'0101'B", assertion: "cn=a,dc=x#'0111'B", want: false},
+		{rule: "uniqueMemberMatch", val: "cn=a,dc=x#'0101'B", assertion: "cn=a,dc=x", want: false},
+		{rule: "uniqueMemberMatch", val: `cn=a\#b,dc=x`, assertion: `CN=A\#B,DC=X`, want: true},
+		{rule: "uniqueMemberMatch", val: `cn=a\#b,dc=x#'1'B`, assertion: `CN=A\#B,DC=X#'1'B`, want: true},
+		{rule: "uniqueMemberMatch", val: `cn=a\#'1'B,dc=x`, assertion: `CN=A\#'1'B,DC=X`, want: true},
+		{rule: "uniqueMemberMatch", val: "cn=#04026162,dc=x", assertion: "cn=ab,dc=x", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.val, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_isBitString(t *testing.T) {
+	tests := map[string]bool{
+		"'0101'B": true,
+		"''B":     true,
+		"'1'B":    true,
+		"0101'B":  false,
+		"'0101'":  false,
+		"'B":      false,
+		"'012'B":  false,
+		"":        false,
+	}
+
+	for s, want := range tests {
+		t.Run(s, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(want, isBitString(s))
+		})
+	}
+}
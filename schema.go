@@ -0,0 +1,726 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidSchemaDesc = errors.New("invalid schema description")
+	ErrSchemaViolation   = errors.New("schema violation")
+)
+
+// extensibleObjectOID is the OID of the extensibleObject object class, which
+// allows an entry to contain any attribute.
+const extensibleObjectOID = "1.3.6.1.4.1.1466.101.120.111"
+
+// Schema describes the attribute types and object classes known to the
+// directory. It is used to determine how attribute values are compared, both
+// in filters and in DNs, by giving the matching rules for each attribute type.
+//
+// Attributes that are not described by the schema are still allowed in
+// entries. Their values are compared case-insensitively.
+type Schema struct {
+	attributeTypes []*AttributeType
+	// attributeTypeIndex maps lower-case names and OIDs of attribute
+	// types to the attribute type.
+	attributeTypeIndex map[string]*AttributeType
+
+	objectClasses []*ObjectClass
+	// objectClassIndex maps lower-case names and OIDs of object classes
+	// to the object class.
+	objectClassIndex map[string]*ObjectClass
+
+	ldapSyntaxes []*LDAPSyntax
+}
+
+// AttributeType is the definition of an attribute type, as described by
+// [RFC 4512, section 4.1.2]. Matching rules and the syntax are inherited from
+// the supertype if not set on the attribute type.
+//
+// [RFC 4512, section 4.1.2]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.2
+type AttributeType struct {
+	OID string
+	// Names are the short names of the attribute type. The first name
+	// is its primary name. Others are aliases.
+	Names              []string
+	Desc               string
+	Obsolete           bool
+	Sup                string
+	Equality           string
+	Ordering           string
+	Substr             string
+	Syntax             string
+	SingleValue        bool
+	Collective         bool
+	NoUserModification bool
+	// Usage is one of userApplications (the default if empty),
+	// directoryOperation, distributedOperation or dSAOperation.
+	Usage string
+
+	sup *AttributeType
+}
+
+// ObjectClassKind is the kind of an [ObjectClass]: abstract, structural or
+// auxiliary.
+type ObjectClassKind int
+
+const (
+	// Structural object classes define the type of object an entry
+	// represents. It is the default kind of an object class.
+	Structural ObjectClassKind = iota
+	// Abstract object classes are templates for other object classes.
+	Abstract
+	// Auxiliary object classes add attributes to an entry of any
+	// structural object class.
+	Auxiliary
+)
+
+// String returns the keyword of the kind as used in object class
+// descriptions.
+func (k ObjectClassKind) String() string {
+	switch k {
+	case Abstract:
+		return "ABSTRACT"
+	case Auxiliary:
+		return "AUXILIARY"
+	default:
+		return "STRUCTURAL"
+	}
+}
+
+// ObjectClass is the definition of an object class, as described by
+// [RFC 4512, section 4.1.1]. Must and May list the attribute types that an
+// entry of the class must and may contain, in addition to those of its
+// superclasses.
+//
+// [RFC 4512, section 4.1.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.1
+type ObjectClass struct {
+	OID string
+	// Names are the short names of the object class. The first name is
+	// its primary name. Others are aliases.
+	Names    []string
+	Desc     string
+	Obsolete bool
+	Sup      []string
+	Kind     ObjectClassKind
+	Must     []string
+	May      []string
+
+	sup []*ObjectClass
+}
+
+// LDAPSyntax is the definition of an LDAP syntax, as described by
+// [RFC 4512, section 4.1.5]. Syntaxes are only used to describe the schema
+// to clients. Values are not checked against them.
+//
+// [RFC 4512, section 4.1.5]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.5
+type LDAPSyntax struct {
+	OID  string
+	Desc string
+}
+
+// schema is the Schema used to compare attribute values and DNs. It starts as
+// the built-in schema (see [NewBuiltinSchema]) and may be added to at startup.
+var schema = mustNewBuiltinSchema()
+
+// NewSchema returns a new empty Schema.
+func NewSchema() *Schema {
+	return &Schema{
+		attributeTypeIndex: map[string]*AttributeType{},
+		objectClassIndex:   map[string]*ObjectClass{},
+	}
+}
+
+// AddAttributeType adds at to the schema. If an attribute type with the same
+// OID is already in the schema, at replaces it, so that schema files such as
+// OpenLDAP's nis.schema can redefine built-in attribute types. An error is
+// returned if any of the names of at are already defined in the schema by a
+// different attribute type, or its supertype is not defined in the schema.
+func (s *Schema) AddAttributeType(at *AttributeType) error {
+	if at.Sup != "" {
+		if at.sup = s.AttributeType(at.Sup); at.sup == nil {
+			return fmt.Errorf("unknown supertype %s of attribute type %s", at.Sup, at.Name())
+		}
+	}
+	old := s.attributeTypeIndex[strings.ToLower(at.OID)]
+	for _, name := range at.Names {
+		if existing, ok := s.attributeTypeIndex[strings.ToLower(name)]; ok && existing != old {
+			return fmt.Errorf("attribute type %s (%s) already defined by %s (%s)", at.Name(), name, existing.Name(), existing.OID)
+		}
+	}
+	if old == nil {
+		s.attributeTypes = append(s.attributeTypes, at)
+	} else {
+		removeSchemaKeys(s.attributeTypeIndex, old, old.OID, old.Names)
+		s.attributeTypes[slices.Index(s.attributeTypes, old)] = at
+		for _, other := range s.attributeTypes {
+			if other.sup == old {
+				other.sup = at
+			}
+		}
+	}
+	for _, key := range append([]string{at.OID}, at.Names...) {
+		s.attributeTypeIndex[strings.ToLower(key)] = at
+	}
+	return nil
+}
+
+// AddObjectClass adds oc to the schema. If an object class with the same OID
+// is already in the schema, oc replaces it. An error is returned if any of the
+// names of oc are already defined in the schema by a different object class,
+// or any of its superclasses or attribute types are not defined in the
+// schema.
+func (s *Schema) AddObjectClass(oc *ObjectClass) error {
+	oc.sup = make([]*ObjectClass, 0, len(oc.Sup))
+	for _, name := range oc.Sup {
+		sup := s.ObjectClass(name)
+		if sup == nil {
+			return fmt.Errorf("unknown superclass %s of object class %s", name, oc.Name())
+		}
+		oc.sup = append(oc.sup, sup)
+	}
+	for _, attr := range slices.Concat(oc.Must, oc.May) {
+		if s.AttributeType(attr) == nil {
+			return fmt.Errorf("unknown attribute type %s in object class %s", attr, oc.Name())
+		}
+	}
+	old := s.objectClassIndex[strings.ToLower(oc.OID)]
+	for _, name := range oc.Names {
+		if existing, ok := s.objectClassIndex[strings.ToLower(name)]; ok && existing != old {
+			return fmt.Errorf("object class %s (%s) already defined by %s (%s)", oc.Name(), name, existing.Name(), existing.OID)
+		}
+	}
+	if old == nil {
+		s.objectClasses = append(s.objectClasses, oc)
+	} else {
+		removeSchemaKeys(s.objectClassIndex, old, old.OID, old.Names)
+		s.objectClasses[slices.Index(s.objectClasses, old)] = oc
+		for _, other := range s.objectClasses {
+			for i, sup := range other.sup {
+				if sup == old {
+					other.sup[i] = oc
+				}
+			}
+		}
+	}
+	for _, key := range append([]string{oc.OID}, oc.Names...) {
+		s.objectClassIndex[strings.ToLower(key)] = oc
+	}
+	return nil
+}
+
+// AddLDAPSyntax adds syn to the schema. If a syntax with the same OID is
+// already in the schema, syn replaces it.
+func (s *Schema) AddLDAPSyntax(syn *LDAPSyntax) {
+	if i := slices.IndexFunc(s.ldapSyntaxes, func(old *LDAPSyntax) bool { return old.OID == syn.OID }); i != -1 {
+		s.ldapSyntaxes[i] = syn
+		return
+	}
+	s.ldapSyntaxes = append(s.ldapSyntaxes, syn)
+}
+
+// removeSchemaKeys removes the OID and names of the schema element elem from
+// index.
+func removeSchemaKeys[T comparable](index map[string]T, elem T, oid string, names []string) {
+	for _, key := range append([]string{oid}, names...) {
+		if index[strings.ToLower(key)] == elem {
+			delete(index, strings.ToLower(key))
+		}
+	}
+}
+
+// ObjectClass returns the object class with the given name or OID. Names are
+// case-insensitive. If the object class is not in the schema, nil is
+// returned.
+func (s *Schema) ObjectClass(nameOrOID string) *ObjectClass {
+	return s.objectClassIndex[strings.ToLower(nameOrOID)]
+}
+
+// AttributeType returns the attribute type for the attribute description
+// attr, which may be any of the names or the OID of the attribute type
+// optionally followed by options (e.g. "cn;lang-en"). Names are
+// case-insensitive. If the attribute type is not in the schema, nil is
+// returned.
+func (s *Schema) AttributeType(attr string) *AttributeType {
+	attrType, _, _ := strings.Cut(attr, ";")
+	return s.attributeTypeIndex[strings.ToLower(attrType)]
+}
+
+// EqualityRule returns the equality matching rule for the attribute
+// description attr. If the attribute type is not in the schema or does not
+// have an equality matching rule that we support, caseIgnoreMatch is
+// returned.
+func (s *Schema) EqualityRule(attr string) *MatchingRule {
+	if mr := s.AttributeType(attr).rule(func(at *AttributeType) string { return at.Equality }); mr != nil {
+		return mr
+	}
+	return LookupMatchingRule("caseIgnoreMatch")
+}
+
+// OrderingRule returns the ordering matching rule for the attribute
+// description attr. If the attribute type does not have an ordering rule,
+// the ordering rule corresponding to its equality rule is returned, falling
+// back to caseIgnoreOrderingMatch.
+func (s *Schema) OrderingRule(attr string) *MatchingRule {
+	if mr := s.AttributeType(attr).rule(func(at *AttributeType) string { return at.Ordering }); mr != nil {
+		return mr
+	}
+	orderingRules := map[string]string{
+		"caseExactMatch":       "caseExactOrderingMatch",
+		"caseExactIA5Match":    "caseExactOrderingMatch",
+		"integerMatch":         "integerOrderingMatch",
+		"numericStringMatch":   "numericStringOrderingMatch",
+		"octetStringMatch":     "octetStringOrderingMatch",
+		"generalizedTimeMatch": "generalizedTimeOrderingMatch",
+	}
+	return LookupMatchingRule(cmp.Or(orderingRules[s.EqualityRule(attr).Name], "caseIgnoreOrderingMatch"))
+}
+
+// SubstringsRule returns the substrings matching rule for the attribute
+// description attr. If the attribute type does not have a substrings rule,
+// the substrings rule corresponding to its equality rule is returned, falling
+// back to caseIgnoreSubstringsMatch.
+func (s *Schema) SubstringsRule(attr string) *MatchingRule {
+	if mr := s.AttributeType(attr).rule(func(at *AttributeType) string { return at.Substr }); mr != nil {
+		return mr
+	}
+	substringsRules := map[string]string{
+		"caseExactMatch":       "caseExactSubstringsMatch",
+		"caseExactIA5Match":    "caseExactIA5SubstringsMatch",
+		"caseIgnoreIA5Match":   "caseIgnoreIA5SubstringsMatch",
+		"numericStringMatch":   "numericStringSubstringsMatch",
+		"telephoneNumberMatch": "telephoneNumberSubstringsMatch",
+		"caseIgnoreListMatch":  "caseIgnoreListSubstringsMatch",
+	}
+	return LookupMatchingRule(cmp.Or(substringsRules[s.EqualityRule(attr).Name], "caseIgnoreSubstringsMatch"))
+}
+
+// attrKey returns the key for the attribute description attr, used to index
+// attributes in an entry and to compare attribute names. It is the lower-case
+// primary name of the attribute type followed by any lower-case options, so
+// that all names and the OID of an attribute type have the same key. If the
+// attribute type is not in the schema, it is the lower-case attr.
+func (s *Schema) attrKey(attr string) string {
+	attr = strings.ToLower(attr)
+	at := s.AttributeType(attr)
+	if at == nil {
+		return attr
+	}
+	_, options, hasOptions := strings.Cut(attr, ";")
+	return strings.ToLower(at.Name()) + If(hasOptions, ";"+options, "")
+}
+
+// Name returns the primary name of the attribute type, or its OID if it has
+// no names.
+func (at *AttributeType) Name() string {
+	if len(at.Names) == 0 {
+		return at.OID
+	}
+	return at.Names[0]
+}
+
+// ValidateEntry validates e against the object classes and attribute types of
+// the schema, returning an error wrapping [ErrSchemaViolation] that names the
+// DN of e for every violation found. No errors are returned if e is valid. An
+// entry is valid if:
+//
+//   - all its object classes and attribute types are in the schema,
+//   - it has exactly one most-specific structural object class, with all
+//     other structural object classes being its superclasses,
+//   - it has all the attributes its object classes and their superclasses
+//     must have,
+//   - all its user attributes are ones its object classes and their
+//     superclasses must or may have, unless one is extensibleObject, and
+//   - no single-valued attribute has more than one value.
+func (s *Schema) ValidateEntry(e *Entry) []error {
+	var errs []error
+	violation := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s: %s", ErrSchemaViolation, e.DN, fmt.Sprintf(format, args...)))
+	}
+
+	// Collect the object classes of the entry and all their superclasses.
+	classes := map[*ObjectClass]bool{}
+	var addClass func(oc *ObjectClass)
+	addClass = func(oc *ObjectClass) {
+		if !classes[oc] {
+			classes[oc] = true
+			for _, sup := range oc.sup {
+				addClass(sup)
+			}
+		}
+	}
+	objectClass, _ := e.GetAttr("objectClass")
+	for _, name := range objectClass.Vals {
+		if oc := s.ObjectClass(name); oc != nil {
+			addClass(oc)
+		} else {
+			violation("unknown object class %s", name)
+		}
+	}
+
+	// Check the structural object classes form a single chain.
+	var structural []string
+	for oc := range classes {
+		if oc.Kind == Structural && !oc.isSuperclassOfAny(maps.Keys(classes)) {
+			structural = append(structural, oc.Name())
+		}
+	}
+	slices.Sort(structural)
+	switch {
+	case len(structural) == 0:
+		violation("no structural object class")
+	case len(structural) > 1:
+		violation("multiple structural object classes: %s", strings.Join(structural, ", "))
+	}
+
+	// Check the attributes against those allowed by the object classes.
+	must := map[string]string{}
+	allowed := map[string]bool{}
+	extensible := false
+	for oc := range classes {
+		for _, attr := range oc.Must {
+			must[s.attrKey(attr)] = attr
+			allowed[s.attrKey(attr)] = true
+		}
+		for _, attr := range oc.May {
+			allowed[s.attrKey(attr)] = true
+		}
+		extensible = extensible || oc.OID == extensibleObjectOID
+	}
+	for _, key := range slices.Sorted(maps.Keys(must)) {
+		if attr, ok := e.GetAttr(key); !ok || len(attr.Vals) == 0 {
+			violation("missing required attribute %s", must[key])
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(e.Attrs)) {
+		attr := e.Attrs[key]
+		at := s.AttributeType(attr.Name)
+		if at == nil {
+			violation("unknown attribute %s", attr.Name)
+			continue
+		}
+		if !at.IsOperational() && !extensible && !allowed[strings.ToLower(at.Name())] {
+			violation("attribute %s not allowed by object classes", attr.Name)
+		}
+		if at.SingleValue && len(attr.Vals) > 1 {
+			violation("single-valued attribute %s has %d values", attr.Name, len(attr.Vals))
+		}
+	}
+	return errs
+}
+
+// isSuperclassOf returns true if oc is a direct or indirect superclass of
+// sub.
+func (oc *ObjectClass) isSuperclassOf(sub *ObjectClass) bool {
+	for _, sup := range sub.sup {
+		if sup == oc || oc.isSuperclassOf(sup) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSuperclassOfAny returns true if oc is a direct or indirect superclass of
+// any of the object classes in subs.
+func (oc *ObjectClass) isSuperclassOfAny(subs iter.Seq[*ObjectClass]) bool {
+	for sub := range subs {
+		if oc.isSuperclassOf(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the primary name of the object class, or its OID if it has no
+// names.
+func (oc *ObjectClass) Name() string {
+	if len(oc.Names) == 0 {
+		return oc.OID
+	}
+	return oc.Names[0]
+}
+
+// IsOperational returns true if the attribute type is an operational
+// attribute - one with a usage other than userApplications.
+func (at *AttributeType) IsOperational() bool {
+	return at.Usage != "" && at.Usage != "userApplications"
+}
+
+// rule returns the matching rule named by the field of the attribute type
+// returned by ruleName, inheriting it from its supertypes if not set. nil is
+// returned if no rule is set or the rule is not supported.
+func (at *AttributeType) rule(ruleName func(*AttributeType) string) *MatchingRule {
+	for ; at != nil; at = at.sup {
+		if name := ruleName(at); name != "" {
+			return LookupMatchingRule(name)
+		}
+	}
+	return nil
+}
+
+// ParseAttributeType parses an AttributeTypeDescription as described in
+// [RFC 4512, section 4.1.2]. e.g.
+//
+//	( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )
+//
+// [RFC 4512, section 4.1.2]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.2
+func ParseAttributeType(desc string) (*AttributeType, error) {
+	d, err := parseSchemaDesc(desc)
+	if err != nil {
+		return nil, err
+	}
+	at := &AttributeType{
+		OID:                d.oid,
+		Names:              d.fields["NAME"],
+		Obsolete:           d.has("OBSOLETE"),
+		SingleValue:        d.has("SINGLE-VALUE"),
+		Collective:         d.has("COLLECTIVE"),
+		NoUserModification: d.has("NO-USER-MODIFICATION"),
+	}
+	for field, dest := range map[string]*string{
+		"DESC":     &at.Desc,
+		"SUP":      &at.Sup,
+		"EQUALITY": &at.Equality,
+		"ORDERING": &at.Ordering,
+		"SUBSTR":   &at.Substr,
+		"SYNTAX":   &at.Syntax,
+		"USAGE":    &at.Usage,
+	} {
+		if *dest, err = d.single(field); err != nil {
+			return nil, err
+		}
+	}
+	if at.Sup == "" && at.Syntax == "" {
+		return nil, fmt.Errorf("%w: attribute type %s has neither SUP nor SYNTAX", ErrInvalidSchemaDesc, at.Name())
+	}
+	switch at.Usage {
+	case "", "userApplications", "directoryOperation", "distributedOperation", "dSAOperation":
+	default:
+		return nil, fmt.Errorf("%w: attribute type %s has invalid usage %s", ErrInvalidSchemaDesc, at.Name(), at.Usage)
+	}
+	return at, nil
+}
+
+// ParseObjectClass parses an ObjectClassDescription as described in
+// [RFC 4512, section 4.1.1]. e.g.
+//
+//	( 2.5.6.6 NAME 'person' SUP top STRUCTURAL MUST ( sn $ cn )
+//	  MAY ( userPassword $ telephoneNumber $ seeAlso $ description ) )
+//
+// [RFC 4512, section 4.1.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.1
+func ParseObjectClass(desc string) (*ObjectClass, error) {
+	d, err := parseSchemaDesc(desc)
+	if err != nil {
+		return nil, err
+	}
+	oc := &ObjectClass{
+		OID:      d.oid,
+		Names:    d.fields["NAME"],
+		Obsolete: d.has("OBSOLETE"),
+		Sup:      d.fields["SUP"],
+		Must:     d.fields["MUST"],
+		May:      d.fields["MAY"],
+	}
+	if oc.Desc, err = d.single("DESC"); err != nil {
+		return nil, err
+	}
+	switch {
+	case d.has("ABSTRACT") && !d.has("STRUCTURAL") && !d.has("AUXILIARY"):
+		oc.Kind = Abstract
+	case d.has("AUXILIARY") && !d.has("STRUCTURAL") && !d.has("ABSTRACT"):
+		oc.Kind = Auxiliary
+	case d.has("ABSTRACT") || d.has("AUXILIARY"):
+		return nil, fmt.Errorf("%w: object class %s has multiple kinds", ErrInvalidSchemaDesc, oc.Name())
+	}
+	return oc, nil
+}
+
+// ParseLDAPSyntax parses a SyntaxDescription as described in
+// [RFC 4512, section 4.1.5]. e.g.
+//
+//	( 1.3.6.1.4.1.1466.115.121.1.15 DESC 'Directory String' )
+//
+// [RFC 4512, section 4.1.5]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.5
+func ParseLDAPSyntax(desc string) (*LDAPSyntax, error) {
+	d, err := parseSchemaDesc(desc)
+	if err != nil {
+		return nil, err
+	}
+	syn := &LDAPSyntax{OID: d.oid}
+	if syn.Desc, err = d.single("DESC"); err != nil {
+		return nil, err
+	}
+	return syn, nil
+}
+
+// schemaDesc is the generic form of a schema element description, such as an
+// attribute type or object class. The fields map the upper-case keywords of
+// the description to their values. Keywords that are flags have no values.
+type schemaDesc struct {
+	oid    string
+	fields map[string][]string
+}
+
+// schemaFlags are the keywords in schema descriptions that take no value.
+var schemaFlags = []string{
+	"OBSOLETE", "SINGLE-VALUE", "COLLECTIVE", "NO-USER-MODIFICATION",
+	"ABSTRACT", "STRUCTURAL", "AUXILIARY",
+}
+
+// parseSchemaDesc parses the generic form of a schema element description
+// as described in [RFC 4512, section 4.1]: a parenthesised OID followed by
+// keywords that are either flags or are followed by a value or a
+// parenthesised list of values separated by optional dollars. Values are
+// either bare words or quoted strings.
+//
+// [RFC 4512, section 4.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1
+func parseSchemaDesc(desc string) (*schemaDesc, error) {
+	tokens, err := tokenizeSchemaDesc(desc)
+	if err != nil {
+		return nil, err
+	}
+	next := func() (schemaToken, bool) {
+		if len(tokens) == 0 {
+			return schemaToken{}, false
+		}
+		t := tokens[0]
+		tokens = tokens[1:]
+		return t, true
+	}
+	errorf := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidSchemaDesc, fmt.Sprintf(format, args...), desc)
+	}
+
+	if t, ok := next(); !ok || !t.is("(") {
+		return nil, errorf("missing '('")
+	}
+	t, ok := next()
+	if !ok || t.quoted || t.isPunct() {
+		return nil, errorf("missing OID")
+	}
+	d := &schemaDesc{oid: t.val, fields: map[string][]string{}}
+
+	for {
+		t, ok := next()
+		switch {
+		case !ok:
+			return nil, errorf("missing ')'")
+		case t.is(")"):
+			if len(tokens) > 0 {
+				return nil, errorf("unexpected %q after ')'", tokens[0].val)
+			}
+			return d, nil
+		case t.quoted || t.isPunct():
+			return nil, errorf("expected keyword, got %q", t.val)
+		}
+
+		keyword := strings.ToUpper(t.val)
+		if _, ok := d.fields[keyword]; ok {
+			return nil, errorf("duplicate %s", keyword)
+		}
+		if slices.Contains(schemaFlags, keyword) {
+			d.fields[keyword] = nil
+			continue
+		}
+
+		t, ok = next()
+		switch {
+		case !ok:
+			return nil, errorf("missing value for %s", keyword)
+		case t.quoted || !t.isPunct():
+			d.fields[keyword] = []string{t.val}
+			continue
+		case !t.is("("):
+			return nil, errorf("unexpected %q for %s", t.val, keyword)
+		}
+		vals := []string{}
+		for {
+			t, ok = next()
+			if !ok {
+				return nil, errorf("missing ')' for %s", keyword)
+			}
+			if t.is(")") {
+				break
+			}
+			if t.is("$") {
+				continue
+			}
+			if t.isPunct() {
+				return nil, errorf("unexpected %q for %s", t.val, keyword)
+			}
+			vals = append(vals, t.val)
+		}
+		d.fields[keyword] = vals
+	}
+}
+
+func (d *schemaDesc) has(keyword string) bool {
+	_, ok := d.fields[keyword]
+	return ok
+}
+
+// single returns the value of a keyword that must have at most one value. An
+// empty string is returned if the keyword is not present.
+func (d *schemaDesc) single(keyword string) (string, error) {
+	vals := d.fields[keyword]
+	if len(vals) > 1 {
+		return "", fmt.Errorf("%w: %s of %s has multiple values", ErrInvalidSchemaDesc, keyword, d.oid)
+	}
+	if len(vals) == 0 {
+		return "", nil
+	}
+	return vals[0], nil
+}
+
+type schemaToken struct {
+	val    string
+	quoted bool
+}
+
+func (t schemaToken) is(punct string) bool {
+	return !t.quoted && t.val == punct
+}
+
+func (t schemaToken) isPunct() bool {
+	return t.is("(") || t.is(")") || t.is("$")
+}
+
+// tokenizeSchemaDesc splits a schema description into tokens. Parentheses
+// and dollars are tokens on their own. Quoted strings are a single token with
+// the quotes removed and the escapes `\27` (') and `\5c` (\) decoded. All
+// other tokens are separated by whitespace.
+func tokenizeSchemaDesc(desc string) ([]schemaToken, error) {
+	var tokens []schemaToken
+	for i := 0; i < len(desc); {
+		switch c := desc[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '$':
+			tokens = append(tokens, schemaToken{val: string(c)})
+			i++
+		case c == '\'':
+			end := strings.IndexByte(desc[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("%w: unterminated quoted string: %s", ErrInvalidSchemaDesc, desc)
+			}
+			val := desc[i+1 : i+1+end]
+			val = strings.NewReplacer(`\27`, "'", `\5c`, `\`, `\5C`, `\`).Replace(val)
+			tokens = append(tokens, schemaToken{val: val, quoted: true})
+			i += end + 2
+		default:
+			end := strings.IndexAny(desc[i:], " \t\n\r()$'")
+			if end == -1 {
+				end = len(desc) - i
+			}
+			tokens = append(tokens, schemaToken{val: desc[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
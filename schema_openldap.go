@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// schemaDirective is a single schema definition read from an OpenLDAP schema
+// file: one of attributetype, objectclass or objectidentifier, with its
+// value. line is the line of the file that the directive starts on.
+type schemaDirective struct {
+	line    int
+	keyword string
+	value   string
+}
+
+// LoadFile loads the attribute types and object classes defined in an
+// OpenLDAP schema file into s. Files with a ".ldif" extension are read as
+// cn=config LDIF (see [Schema.ReadLDIF]). All other files are read as
+// slapd.conf schema files (see [Schema.ReadSlapdSchema]).
+func (s *Schema) LoadFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+
+	if strings.EqualFold(filepath.Ext(filename), ".ldif") {
+		err = s.ReadLDIF(f)
+	} else {
+		err = s.ReadSlapdSchema(f)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// ReadSlapdSchema reads schema definitions in the slapd.conf format used by
+// OpenLDAP .schema files and adds them to s. e.g.
+//
+//	objectidentifier nisSchema 1.3.6.1.1.1
+//	attributetype ( nisSchema:1.1.0 NAME 'uidNumber'
+//		EQUALITY integerMatch
+//		SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 SINGLE-VALUE )
+//
+// A definition continues on lines starting with whitespace. Lines starting
+// with '#' are comments. The attributetype, objectclass and objectidentifier
+// directives are supported. Any other directive is an error.
+func (s *Schema) ReadSlapdSchema(r io.Reader) error {
+	var directives []schemaDirective
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#"):
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if len(directives) == 0 {
+				return fmt.Errorf("line %d: continuation line without directive", lineNum)
+			}
+			directives[len(directives)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		keyword := strings.Fields(line)[0]
+		value := strings.TrimSpace(line[len(keyword):])
+		directives = append(directives, schemaDirective{line: lineNum, keyword: keyword, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return s.addDirectives(directives)
+}
+
+// ldifSchemaAttrs maps the lower-case names of the cn=config attributes that
+// hold schema definitions to the equivalent slapd.conf directive.
+var ldifSchemaAttrs = map[string]string{
+	"olcattributetypes":   "attributetype",
+	"olcobjectclasses":    "objectclass",
+	"olcobjectidentifier": "objectidentifier",
+}
+
+// ldifOrderingPrefix matches the "{n}" prefix on values of ordered cn=config
+// attributes.
+var ldifOrderingPrefix = regexp.MustCompile(`^\{\d+\}`)
+
+// ReadLDIF reads schema definitions in the cn=config LDIF format used by
+// OpenLDAP .ldif schema files and adds them to s. e.g.
+//
+//	dn: cn=nis,cn=schema,cn=config
+//	objectClass: olcSchemaConfig
+//	cn: nis
+//	olcObjectIdentifier: {0}nisSchema 1.3.6.1.1.1
+//	olcAttributeTypes: {0}( nisSchema:1.1.0 NAME 'uidNumber'
+//	  EQUALITY integerMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.27
+//	  SINGLE-VALUE )
+//
+// The definitions are taken from the olcAttributeTypes, olcObjectClasses and
+// olcObjectIdentifier attributes. Folded lines, base64-encoded values and the
+// "{n}" ordering prefix of values are supported. All other attributes are
+// ignored.
+func (s *Schema) ReadLDIF(r io.Reader) error {
+	type ldifLine struct {
+		num  int
+		text string
+	}
+	var lines []ldifLine
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		// Comments may be folded too, so they are unfolded here along
+		// with everything else and skipped below.
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") {
+			lines = append(lines, ldifLine{num: lineNum, text: line})
+			continue
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("line %d: continuation line without attribute", lineNum)
+		}
+		lines[len(lines)-1].text += line[1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var directives []schemaDirective
+	for _, line := range lines {
+		if line.text == "" || strings.HasPrefix(line.text, "#") {
+			continue
+		}
+		attr, value, ok := strings.Cut(line.text, ":")
+		if !ok {
+			return fmt.Errorf("line %d: missing ':' in %q", line.num, line.text)
+		}
+		keyword, ok := ldifSchemaAttrs[strings.ToLower(attr)]
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, ":"):
+			b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line.num, err)
+			}
+			value = string(b)
+		case strings.HasPrefix(value, "<"):
+			return fmt.Errorf("line %d: URL values not supported for %s", line.num, attr)
+		}
+		value = ldifOrderingPrefix.ReplaceAllString(strings.TrimSpace(value), "")
+		directives = append(directives, schemaDirective{line: line.num, keyword: keyword, value: value})
+	}
+	return s.addDirectives(directives)
+}
+
+// addDirectives adds the attribute types and object classes defined by
+// directives to s, expanding any OID macros defined by objectidentifier
+// directives in their OIDs and syntaxes.
+func (s *Schema) addDirectives(directives []schemaDirective) error {
+	macros := oidMacros{}
+	for _, d := range directives {
+		var err error
+		switch strings.ToLower(d.keyword) {
+		case "objectidentifier":
+			err = macros.define(d.value)
+		case "attributetype", "attributetypes":
+			var at *AttributeType
+			if at, err = ParseAttributeType(d.value); err == nil {
+				at.OID, err = macros.expand(at.OID)
+			}
+			if err == nil && at.Syntax != "" {
+				at.Syntax, err = macros.expand(at.Syntax)
+			}
+			if err == nil {
+				err = s.AddAttributeType(at)
+			}
+		case "objectclass", "objectclasses":
+			var oc *ObjectClass
+			if oc, err = ParseObjectClass(d.value); err == nil {
+				oc.OID, err = macros.expand(oc.OID)
+			}
+			if err == nil {
+				err = s.AddObjectClass(oc)
+			}
+		default:
+			err = fmt.Errorf("unsupported directive %q", d.keyword)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", d.line, err)
+		}
+	}
+	return nil
+}
+
+// oidMacros maps the lower-case names of OpenLDAP objectidentifier macros to
+// the OIDs they stand for.
+type oidMacros map[string]string
+
+// define defines a macro from the value of an objectidentifier directive,
+// which is the name of the macro followed by its OID. The OID may itself use
+// a previously defined macro.
+func (m oidMacros) define(def string) error {
+	fields := strings.Fields(def)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid objectidentifier: %q", def)
+	}
+	oid, err := m.expand(fields[1])
+	if err != nil {
+		return err
+	}
+	m[strings.ToLower(fields[0])] = oid
+	return nil
+}
+
+// expand expands an OID of the form "macro" or "macro:suffix" to the OID of
+// the macro, followed by ".suffix" if present. OIDs that start with a digit
+// are returned unchanged. Any length bound on a syntax OID (e.g. "{256}") is
+// preserved.
+func (m oidMacros) expand(oid string) (string, error) {
+	if oid == "" || (oid[0] >= '0' && oid[0] <= '9') {
+		return oid, nil
+	}
+	var bound string
+	if i := strings.IndexByte(oid, '{'); i != -1 {
+		oid, bound = oid[:i], oid[i:]
+	}
+	name, suffix, hasSuffix := strings.Cut(oid, ":")
+	expanded, ok := m[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("undefined objectidentifier macro in %q", oid)
+	}
+	if hasSuffix {
+		expanded += "." + suffix
+	}
+	return expanded + bound, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Schema_LoadFile_Slapd(t *testing.T) {
+	is := is.New(t)
+	s, err := NewBuiltinSchema()
+	is.NoErr(err)
+
+	is.NoErr(s.LoadFile("testdata/schema/openssh-lpk.schema"))
+	at := s.AttributeType("sshPublicKey")
+	is.True(at != nil)
+	is.Equal("1.3.6.1.4.1.24552.500.1.1.1.13", at.OID)
+	is.Equal("octetStringMatch", s.EqualityRule("sshPublicKey").Name)
+
+	oc := s.ObjectClass("ldapPublicKey")
+	is.True(oc != nil)
+	is.Equal(Auxiliary, oc.Kind)
+	is.Equal([]string{"top"}, oc.Sup)
+	is.Equal([]string{"sshPublicKey", "uid"}, oc.Must)
+	is.Equal("MANDATORY: OpenSSH LPK objectclass", oc.Desc)
+}
+
+func Test_Schema_LoadFile_Macros(t *testing.T) {
+	is := is.New(t)
+	s, err := NewBuiltinSchema()
+	is.NoErr(err)
+	builtin := s.AttributeType("uidNumber")
+
+	is.NoErr(s.LoadFile("testdata/schema/macros.schema"))
+
+	// The built-in uidNumber is replaced by the one in the file.
+	at := s.AttributeType("uidNumber")
+	is.True(at != builtin)
+	is.Equal("1.3.6.1.1.1.1.0", at.OID)
+	is.Equal("1.3.6.1.4.1.1466.115.121.1.27", at.Syntax)
+	is.Equal(at, s.AttributeType("1.3.6.1.1.1.1.0"))
+
+	at = s.AttributeType("homeDirectory")
+	is.Equal("1.3.6.1.1.1.1.3", at.OID)
+	is.Equal("1.3.6.1.4.1.1466.115.121.1.26{1024}", at.Syntax)
+
+	oc := s.ObjectClass("posixAccount")
+	is.True(oc != nil)
+	is.Equal("1.3.6.1.1.1.2.0", oc.OID)
+}
+
+func Test_Schema_LoadFile_LDIF(t *testing.T) {
+	is := is.New(t)
+	s, err := NewBuiltinSchema()
+	is.NoErr(err)
+
+	is.NoErr(s.LoadFile("testdata/schema/sudo.ldif"))
+
+	at := s.AttributeType("sudoUser")
+	is.True(at != nil)
+	is.Equal("1.3.6.1.4.1.15953.9.1.1", at.OID)
+	is.Equal("User(s) who may run sudo", at.Desc)
+	is.Equal("caseExactIA5SubstringsMatch", s.SubstringsRule("sudoUser").Name)
+
+	at = s.AttributeType("sudoHost")
+	is.True(at != nil)
+	is.Equal("Host(s) who may run sudo", at.Desc)
+	is.Equal("1.3.6.1.4.1.1466.115.121.1.26", at.Syntax)
+
+	at = s.AttributeType("sudoCommand")
+	is.True(at != nil)
+	is.Equal("Command(s) to be executed by sudo", at.Desc)
+
+	oc := s.ObjectClass("sudoRole")
+	is.True(oc != nil)
+	is.Equal(Structural, oc.Kind)
+	is.Equal([]string{"cn"}, oc.Must)
+	is.Equal([]string{"sudoUser", "sudoHost", "sudoCommand", "description"}, oc.May)
+}
+
+func Test_Schema_LoadFile_Fail(t *testing.T) {
+	tests := map[string]string{
+		"testdata/schema/missing.schema":           "no such file",
+		"testdata/schema/invalid-directive.schema": `line 2: unsupported directive "ditcontentrule"`,
+		"testdata/schema/undefined-macro.schema":   "line 1: undefined objectidentifier macro",
+		"testdata/schema/unknown-attr.ldif":        "line 2: unknown attribute type noSuchAttr",
+	}
+	for filename, want := range tests {
+		t.Run(filename, func(t *testing.T) {
+			is := is.New(t)
+			s, err := NewBuiltinSchema()
+			is.NoErr(err)
+			err = s.LoadFile(filename)
+			is.True(err != nil)
+			is.True(strings.Contains(err.Error(), want))
+		})
+	}
+}
+
+func Test_Schema_ReadSlapdSchema_Continuation(t *testing.T) {
+	is := is.New(t)
+	s := NewSchema()
+	err := s.ReadSlapdSchema(strings.NewReader("\t( 1.2.3 NAME 'x' SYNTAX 1.2 )\n"))
+	is.True(err != nil)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ParseAttributeType(t *testing.T) {
+	is := is.New(t)
+
+	at, err := ParseAttributeType(`( 2.5.4.3 NAME ( 'cn' 'commonName' )
+		DESC 'RFC4519: common name(s) for which the entity is known by'
+		SUP name )`)
+	is.NoErr(err)
+	is.Equal(&AttributeType{
+		OID:   "2.5.4.3",
+		Names: []string{"cn", "commonName"},
+		Desc:  "RFC4519: common name(s) for which the entity is known by",
+		Sup:   "name",
+	}, at)
+	is.Equal("cn", at.Name())
+
+	at, err = ParseAttributeType("( 2.5.18.1 NAME 'createTimestamp' EQUALITY generalizedTimeMatch " +
+		"ORDERING generalizedTimeOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.24 " +
+		"SINGLE-VALUE NO-USER-MODIFICATION USAGE directoryOperation )")
+	is.NoErr(err)
+	is.Equal(&AttributeType{
+		OID:                "2.5.18.1",
+		Names:              []string{"createTimestamp"},
+		Equality:           "generalizedTimeMatch",
+		Ordering:           "generalizedTimeOrderingMatch",
+		Syntax:             "1.3.6.1.4.1.1466.115.121.1.24",
+		SingleValue:        true,
+		NoUserModification: true,
+		Usage:              "directoryOperation",
+	}, at)
+	is.True(at.IsOperational())
+
+	at, err = ParseAttributeType(`( 1.2.3 DESC 'it\27s a \5c' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{256} )`)
+	is.NoErr(err)
+	is.Equal(`it's a \`, at.Desc)
+	is.Equal("1.2.3", at.Name())
+	is.True(!at.IsOperational())
+}
+
+func Test_ParseAttributeType_Fail(t *testing.T) {
+	tests := map[string]string{
+		"empty":              "",
+		"no open paren":      "2.5.4.3 NAME 'cn' SUP name )",
+		"no close paren":     "( 2.5.4.3 NAME 'cn' SUP name",
+		"trailing":           "( 2.5.4.3 NAME 'cn' SUP name ) x",
+		"no oid":             "( NAME 'cn' SUP name )",
+		"quoted oid":         "( '2.5.4.3' NAME 'cn' SUP name )",
+		"unterminated quote": "( 2.5.4.3 NAME 'cn SUP name )",
+		"duplicate keyword":  "( 2.5.4.3 NAME 'cn' NAME 'commonName' SUP name )",
+		"missing value":      "( 2.5.4.3 NAME 'cn' SUP )",
+		"unclosed list":      "( 2.5.4.3 NAME ( 'cn' 'commonName' SUP name )",
+		"multiple sup":       "( 2.5.4.3 NAME 'cn' SUP ( name description ) )",
+		"no sup or syntax":   "( 2.5.4.3 NAME 'cn' )",
+		"invalid usage":      "( 2.5.4.3 NAME 'cn' SUP name USAGE sometimes )",
+	}
+	for name, desc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			_, err := ParseAttributeType(desc)
+			is.True(errors.Is(err, ErrInvalidSchemaDesc))
+		})
+	}
+}
+
+func Test_Schema_AttributeType(t *testing.T) {
+	is := is.New(t)
+
+	cn := schema.AttributeType("cn")
+	is.True(cn != nil)
+	is.Equal("2.5.4.3", cn.OID)
+	is.Equal(cn, schema.AttributeType("CommonName"))
+	is.Equal(cn, schema.AttributeType("2.5.4.3"))
+	is.Equal(cn, schema.AttributeType("cn;lang-en"))
+	is.Equal(nil, schema.AttributeType("unknownAttr"))
+
+	is.Equal("cn", schema.attrKey("commonName"))
+	is.Equal("cn", schema.attrKey("2.5.4.3"))
+	is.Equal("cn;lang-en", schema.attrKey("CN;Lang-EN"))
+	is.Equal("unknownattr", schema.attrKey("unknownAttr"))
+}
+
+func Test_Schema_AddAttributeType(t *testing.T) {
+	is := is.New(t)
+	s := NewSchema()
+
+	name := &AttributeType{OID: "2.5.4.41", Names: []string{"name"}, Equality: "caseExactMatch", Syntax: "1.3.6.1.4.1.1466.115.121.1.15"}
+	is.NoErr(s.AddAttributeType(name))
+
+	// Duplicate name of a different attribute type
+	is.True(s.AddAttributeType(&AttributeType{OID: "1.2.3", Names: []string{"NAME"}, Syntax: "1.3.6.1.4.1.1466.115.121.1.15"}) != nil)
+	is.Equal(nil, s.AttributeType("1.2.3"))
+
+	// Unknown supertype
+	is.True(s.AddAttributeType(&AttributeType{OID: "2.5.4.3", Names: []string{"cn"}, Sup: "missing"}) != nil)
+	is.Equal(nil, s.AttributeType("cn"))
+
+	// Matching rules are inherited from the supertype.
+	is.NoErr(s.AddAttributeType(&AttributeType{OID: "2.5.4.3", Names: []string{"cn"}, Sup: "name"}))
+	is.Equal("caseExactMatch", s.EqualityRule("cn").Name)
+	is.Equal("caseExactOrderingMatch", s.OrderingRule("cn").Name)
+	is.Equal("caseExactSubstringsMatch", s.SubstringsRule("cn").Name)
+
+	// Redefining an attribute type by OID replaces it, including as the
+	// supertype of others.
+	is.NoErr(s.AddAttributeType(&AttributeType{OID: "2.5.4.41", Names: []string{"name", "fullName"}, Syntax: "1.3.6.1.4.1.1466.115.121.1.15"}))
+	is.Equal(s.AttributeType("name"), s.AttributeType("fullName"))
+	is.Equal("caseIgnoreMatch", s.EqualityRule("cn").Name)
+}
+
+func Test_Schema_Rules(t *testing.T) {
+	type testcase struct {
+		attr                     string
+		equality, ordering, subs string
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		is.Equal(tt.equality, schema.EqualityRule(tt.attr).Name)
+		is.Equal(tt.ordering, schema.OrderingRule(tt.attr).Name)
+		is.Equal(tt.subs, schema.SubstringsRule(tt.attr).Name)
+	}
+
+	tests := []testcase{
+		{"cn", "caseIgnoreMatch", "caseIgnoreOrderingMatch", "caseIgnoreSubstringsMatch"},
+		{"uidNumber", "integerMatch", "integerOrderingMatch", "caseIgnoreSubstringsMatch"},
+		{"dc", "caseIgnoreIA5Match", "caseIgnoreOrderingMatch", "caseIgnoreIA5SubstringsMatch"},
+		{"homeDirectory", "caseExactIA5Match", "caseExactOrderingMatch", "caseExactIA5SubstringsMatch"},
+		{"automountKey", "caseExactMatch", "caseExactOrderingMatch", "caseExactSubstringsMatch"},
+		{"telephoneNumber", "telephoneNumberMatch", "caseIgnoreOrderingMatch", "telephoneNumberSubstringsMatch"},
+		{"userPassword", "octetStringMatch", "octetStringOrderingMatch", "caseIgnoreSubstringsMatch"},
+		{"unknownAttr", "caseIgnoreMatch", "caseIgnoreOrderingMatch", "caseIgnoreSubstringsMatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.attr, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_ParseObjectClass(t *testing.T) {
+	is := is.New(t)
+
+	oc, err := ParseObjectClass(`( 2.5.6.6 NAME 'person' DESC 'RFC2256: a person' SUP top STRUCTURAL
+		MUST ( sn $ cn ) MAY ( userPassword $ telephoneNumber $ seeAlso $ description ) )`)
+	is.NoErr(err)
+	is.Equal(&ObjectClass{
+		OID:   "2.5.6.6",
+		Names: []string{"person"},
+		Desc:  "RFC2256: a person",
+		Sup:   []string{"top"},
+		Kind:  Structural,
+		Must:  []string{"sn", "cn"},
+		May:   []string{"userPassword", "telephoneNumber", "seeAlso", "description"},
+	}, oc)
+
+	oc, err = ParseObjectClass("( 2.5.6.0 NAME 'top' ABSTRACT MUST objectClass )")
+	is.NoErr(err)
+	is.Equal(Abstract, oc.Kind)
+	is.Equal([]string{"objectClass"}, oc.Must)
+
+	_, err = ParseObjectClass("( 1.2.3 NAME 'bad' ABSTRACT AUXILIARY )")
+	is.True(errors.Is(err, ErrInvalidSchemaDesc))
+}
+
+func Test_Schema_ValidateEntry(t *testing.T) {
+	type testcase struct {
+		name  string
+		entry map[string]any
+		want  []string
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		tt.entry["dn"] = "uid=jsmith,ou=people,dc=example,dc=com"
+		e, err := NewEntryFromMap(tt.entry)
+		is.NoErr(err)
+
+		errs := schema.ValidateEntry(e)
+		got := make([]string, 0, len(errs))
+		for _, err := range errs {
+			is.True(errors.Is(err, ErrSchemaViolation))
+			got = append(got, err.Error())
+		}
+		want := make([]string, 0, len(tt.want))
+		for _, w := range tt.want {
+			want = append(want, "schema violation: uid=jsmith,ou=people,dc=example,dc=com: "+w)
+		}
+		is.Equal(want, got)
+	}
+
+	posixAccount := func(extra map[string]any) map[string]any {
+		e := map[string]any{
+			"objectClass":   []any{"top", "account", "posixAccount"},
+			"uid":           "jsmith",
+			"cn":            "John Smith",
+			"uidNumber":     10000.0,
+			"gidNumber":     10000.0,
+			"homeDirectory": "/home/jsmith",
+		}
+		for k, v := range extra {
+			if v == nil {
+				delete(e, k)
+			} else {
+				e[k] = v
+			}
+		}
+		return e
+	}
+
+	tests := []testcase{
+		{name: "valid posixAccount", entry: posixAccount(nil)},
+		{
+			name: "valid inetOrgPerson",
+			entry: map[string]any{
+				"objectClass": []any{"inetOrgPerson", "posixAccount", "shadowAccount"},
+				"uid":         "jsmith", "cn": "John Smith", "sn": "Smith", "mail": "jsmith@example.com",
+				"uidNumber": 10000.0, "gidNumber": 10000.0, "homeDirectory": "/home/jsmith",
+				"shadowExpire": 19000.0, "2.5.4.42": "John",
+			},
+		},
+		{
+			name:  "valid extensibleObject",
+			entry: posixAccount(map[string]any{"objectClass": []any{"account", "posixAccount", "extensibleObject"}, "mail": "x@example.com"}),
+		},
+		{
+			name:  "operational attribute",
+			entry: posixAccount(map[string]any{"createTimestamp": "20250101000000Z"}),
+		},
+		{
+			name:  "missing required",
+			entry: posixAccount(map[string]any{"homeDirectory": nil, "cn": nil}),
+			want:  []string{"missing required attribute cn", "missing required attribute homeDirectory"},
+		},
+		{
+			name:  "unknown attribute",
+			entry: posixAccount(map[string]any{"uidNumbr": 10000.0}),
+			want:  []string{"unknown attribute uidNumbr"},
+		},
+		{
+			name:  "not allowed",
+			entry: posixAccount(map[string]any{"mail": "jsmith@example.com"}),
+			want:  []string{"attribute mail not allowed by object classes"},
+		},
+		{
+			name:  "single-valued",
+			entry: posixAccount(map[string]any{"loginShell": []any{"/bin/sh", "/bin/bash"}}),
+			want:  []string{"single-valued attribute loginShell has 2 values"},
+		},
+		{
+			name:  "unknown object class",
+			entry: posixAccount(map[string]any{"objectClass": []any{"account", "posixAcount"}}),
+			want: []string{
+				"unknown object class posixAcount",
+				"attribute cn not allowed by object classes",
+				"attribute gidNumber not allowed by object classes",
+				"attribute homeDirectory not allowed by object classes",
+				"attribute uidNumber not allowed by object classes",
+			},
+		},
+		{
+			name:  "no structural",
+			entry: posixAccount(map[string]any{"objectClass": []any{"top", "posixAccount"}}),
+			want:  []string{"no structural object class"},
+		},
+		{
+			name:  "multiple structural",
+			entry: posixAccount(map[string]any{"objectClass": []any{"account", "posixAccount", "person"}, "sn": "Smith"}),
+			want:  []string{"multiple structural object classes: account, person"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
@@ -1,92 +1,550 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"iter"
 	"log/slog"
 	"maps"
 	"slices"
+	"strings"
+	"sync"
 
 	"github.com/jimlambrt/gldap"
 )
 
+// Server serves the entries of a DB over LDAP, and over LDAPS if it has a
+// TLS configuration.
 type Server struct {
+	db *DB
+
+	// Writers are the DNs of the entries that may add, modify and delete
+	// entries once bound. If there are none, the DB is read-only.
+	Writers []DN
+
+	// TLSConfig is the TLS configuration used to serve LDAPS. It must be
+	// set for Run to serve LDAPS, and for clients to start TLS with the
+	// StartTLS extended operation on connections without it.
+	TLSConfig *tls.Config
+
+	// RequireTLS rejects binds on connections that do not use TLS, so that
+	// passwords are not sent in cleartext.
+	RequireTLS bool
+
+	// ClientCertMapping maps the verified client certificates of TLS
+	// connections to the DNs of entries, for clients to bind as with the
+	// SASL EXTERNAL mechanism. If it is nil, SASL EXTERNAL is not supported.
+	// Client certificates are only requested if TLSConfig has ClientCAs.
+	ClientCertMapping *ClientCertMapping
+
+	// mu guards db, which is written by the add, modify and delete
+	// handlers while other handlers read it.
+	mu sync.RWMutex
+
+	// listeners are the listeners started by Run, for Stop to stop.
+	listeners   []*listener
+	listenersMu sync.Mutex
+
+	// supportedControls, supportedExtensions and supportedSASLMechanisms
+	// list the OIDs of the controls and extended operations, and the names
+	// of the SASL mechanisms, that the server supports. They are published
+	// in the root DSE.
+	supportedControls       []string
+	supportedExtensions     []string
+	supportedSASLMechanisms []string
+}
+
+// listener serves LDAP for a Server on one address, with its own gldap
+// server. gldap numbers the connections of each of its servers from 1, so
+// the state of the connections is kept by each listener, and the request
+// handlers are methods of the listener.
+type listener struct {
+	*Server
 	ldap *gldap.Server
-	db   *DB
+	addr string
+	// tls is whether connections use TLS from the start, for LDAPS.
+	tls bool
+
+	// binds maps connection IDs to the DN bound on the connection.
+	// Connections that are not bound or are bound anonymously are absent.
+	binds   map[int]DN
+	bindsMu sync.Mutex
+}
+
+// vendorName is published in the root DSE, along with the version of the
+// server as the vendorVersion.
+const vendorName = "foxygo.at"
+
+// allOpAttrsFeature is the OID of the feature of returning all operational
+// attributes when "+" is requested, as described in [RFC 3673].
+//
+// [RFC 3673]: https://datatracker.ietf.org/doc/html/rfc3673
+const allOpAttrsFeature = "1.3.6.1.4.1.4203.1.5.1"
+
+// saslExternal is the name of the SASL EXTERNAL mechanism, which
+// authenticates with the client certificate of a TLS connection, as
+// described in [RFC 4513, section 5.2.3].
+//
+// [RFC 4513, section 5.2.3]: https://datatracker.ietf.org/doc/html/rfc4513#section-5.2.3
+const saslExternal = "EXTERNAL"
+
+func NewServer(db *DB) *Server {
+	return &Server{db: db}
+}
+
+// Run serves LDAP on the address listen and LDAPS on the address
+// ldapsListen, skipping either if it is empty, until one of them fails or
+// Stop is called. Serving LDAPS requires TLSConfig to be set.
+func (s *Server) Run(listen, ldapsListen string) error {
+	if listen == "" && ldapsListen == "" {
+		return errors.New("no address to listen on")
+	}
+	if ldapsListen != "" && s.TLSConfig == nil {
+		return errors.New("LDAPS requires a TLS certificate and key")
+	}
+
+	var listeners []*listener
+	for _, addr := range []struct {
+		addr string
+		tls  bool
+	}{{listen, false}, {ldapsListen, true}} {
+		if addr.addr == "" {
+			continue
+		}
+		l, err := s.newListener(addr.addr, addr.tls)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if s.TLSConfig != nil {
+		s.supportedExtensions = []string{string(gldap.ExtendedOperationStartTLS)}
+	}
+	if s.ClientCertMapping != nil {
+		s.supportedSASLMechanisms = []string{saslExternal}
+	}
+	s.listenersMu.Lock()
+	s.listeners = listeners
+	s.listenersMu.Unlock()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() { errs <- l.run() }()
+	}
+	err := <-errs
+	s.Stop() //nolint:errcheck,gosec // the first error is returned
+	return err
+}
+
+// Stop stops the listeners started by Run, waiting for their connections to
+// close.
+func (s *Server) Stop() error {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.ldap.Stop())
+	}
+	return errors.Join(errs...)
 }
 
-func NewServer(db *DB) (*Server, error) {
-	ls, err := gldap.NewServer()
+func (s *Server) newListener(addr string, useTLS bool) (*listener, error) {
+	l := &listener{Server: s, addr: addr, tls: useTLS, binds: map[int]DN{}}
+
+	ls, err := gldap.NewServer(gldap.WithOnClose(l.handleClose))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create server: %w", err)
 	}
+	l.ldap = ls
 
 	m, err := gldap.NewMux()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create mux: %w", err)
 	}
 
-	s := &Server{
-		ldap: ls,
-		db:   db,
+	m.Bind(l.handleBind)         //nolint:errcheck,gosec // cannot error
+	m.SASLBind(l.handleBind)     //nolint:errcheck,gosec // cannot error
+	m.Search(l.handleSearch)     //nolint:errcheck,gosec // cannot error
+	m.Compare(l.handleCompare)   //nolint:errcheck,gosec // cannot error
+	m.Add(l.handleAdd)           //nolint:errcheck,gosec // cannot error
+	m.Modify(l.handleModify)     //nolint:errcheck,gosec // cannot error
+	m.Delete(l.handleDelete)     //nolint:errcheck,gosec // cannot error
+	m.ModifyDN(l.handleModifyDN) //nolint:errcheck,gosec // cannot error
+	if s.TLSConfig != nil {
+		m.ExtendedOperation(l.handleStartTLS, gldap.ExtendedOperationStartTLS) //nolint:errcheck,gosec // cannot error
 	}
+	ls.Router(m) //nolint:errcheck,gosec // cannot error
 
-	m.Bind(s.handleBind)     //nolint:errcheck,gosec // cannot error
-	m.Search(s.handleSearch) //nolint:errcheck,gosec // cannot error
-	ls.Router(m)             //nolint:errcheck,gosec // cannot error
-
-	return s, nil
+	return l, nil
 }
 
-func (s *Server) Run(listen string) error {
-	slog.Info("Server listening", "address", listen)
-	return s.ldap.Run(listen)
+func (l *listener) run() error {
+	var opts []gldap.Option
+	if l.tls {
+		opts = append(opts, gldap.WithTLSConfig(l.TLSConfig))
+	}
+	slog.Info("Server listening", "address", l.addr, "tls", l.tls)
+	return l.ldap.Run(l.addr, opts...)
 }
 
-func (s *Server) handleBind(w *gldap.ResponseWriter, r *gldap.Request) {
+func (l *listener) handleBind(w *gldap.ResponseWriter, r *gldap.Request) {
 	// Set the default response to InvalidCredentials, so we only
 	// return success if explicitly overridden.
 	resp := r.NewBindResponse(gldap.WithResponseCode(gldap.ResultInvalidCredentials))
 	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
 
-	m, err := r.GetSimpleBindMessage()
-	if err != nil {
+	// A bind request resets the connection to anonymous until it succeeds.
+	l.setBindDN(r.ConnectionID(), nil)
+
+	if l.RequireTLS && !usesTLS(r) {
+		slog.Error("bind without TLS")
+		resp.SetResultCode(gldap.ResultConfidentialityRequired)
+		resp.SetDiagnosticMessage("TLS is required to bind")
+		return
+	}
+
+	var bindDN DN
+	var ok bool
+	if m, err := r.GetSASLBindMessage(); err == nil {
+		bindDN, ok = l.saslBind(r, m, resp)
+	} else if m, err := r.GetSimpleBindMessage(); err == nil {
+		bindDN, ok = l.simpleBind(m)
+	} else {
 		slog.Error("Bind with non-bind message", "error", err.Error())
 		return
 	}
+	if !ok {
+		return
+	}
+	// Override InvalidCredentials set above.
+	resp.SetResultCode(gldap.ResultSuccess)
+	l.setBindDN(r.ConnectionID(), bindDN)
+}
 
+// simpleBind authenticates the simple bind m, returning the DN bound, or
+// nil for an anonymous bind, and whether it succeeded.
+func (l *listener) simpleBind(m *gldap.SimpleBindMessage) (DN, bool) {
 	switch {
 	case m.UserName == "" && m.Password == "":
 		slog.Info("anonymous bind")
-	case m.UserName != "" && m.Password != "":
-		bindDN, err := NewDN(m.UserName)
-		if err != nil {
-			slog.Error("bind with invalid DN", "error", err.Error(), "username", m.UserName)
+		return nil, true
+	case m.UserName == "":
+		slog.Error("invalid bind: missing username")
+		return nil, false
+	case m.Password == "":
+		slog.Error("invalid bind: missing password")
+		return nil, false
+	}
+	bindDN, err := NewDN(m.UserName)
+	if err != nil {
+		slog.Error("bind with invalid DN", "error", err.Error(), "username", m.UserName)
+		return nil, false
+	}
+	l.mu.RLock()
+	node := l.db.DIT.Find(bindDN)
+	if node != nil {
+		err = node.Entry.Authenticate(string(m.Password))
+	}
+	l.mu.RUnlock()
+	if node == nil {
+		slog.Error("bind with unknown DN", "username", m.UserName)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("bind failed", "username", m.UserName, "error", err)
+		return nil, false
+	}
+	slog.Info("simple bind", "username", m.UserName)
+	return bindDN, true
+}
+
+// saslBind authenticates the SASL bind m, returning the DN bound and
+// whether it succeeded. Only the EXTERNAL mechanism is supported, which
+// binds as the entry that the verified client certificate of the connection
+// maps to with the ClientCertMapping. The client may give the DN of that
+// entry as the authorization identity, but no other.
+func (l *listener) saslBind(r *gldap.Request, m *gldap.SASLBindMessage, resp *gldap.BindResponse) (DN, bool) {
+	if m.Mechanism != saslExternal || l.ClientCertMapping == nil {
+		slog.Error("bind with unsupported SASL mechanism", "mechanism", m.Mechanism)
+		resp.SetResultCode(gldap.ResultAuthMethodNotSupported)
+		return nil, false
+	}
+	state, ok := r.TLSConnectionState()
+	if !ok || len(state.VerifiedChains) == 0 {
+		slog.Error("SASL EXTERNAL bind without a client certificate")
+		resp.SetResultCode(gldap.ResultInappropriateAuthentication)
+		return nil, false
+	}
+	cert := state.VerifiedChains[0][0]
+	bindDN, err := l.ClientCertMapping.DN(cert)
+	if err != nil {
+		slog.Error("SASL EXTERNAL bind with unmapped certificate", "subject", cert.Subject.String(), "error", err.Error())
+		return nil, false
+	}
+	if authzID := string(m.Credentials); authzID != "" {
+		authzDN, err := NewDN(strings.TrimPrefix(authzID, "dn:"))
+		if !strings.HasPrefix(authzID, "dn:") || err != nil || !authzDN.Equal(bindDN) {
+			slog.Error("SASL EXTERNAL bind with another authorization identity", "dn", bindDN.String(), "authzID", authzID)
+			resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+			return nil, false
+		}
+	}
+	l.mu.RLock()
+	node := l.db.DIT.Find(bindDN)
+	l.mu.RUnlock()
+	if node == nil {
+		slog.Error("SASL EXTERNAL bind with unknown DN", "dn", bindDN.String(), "subject", cert.Subject.String())
+		return nil, false
+	}
+	slog.Info("SASL EXTERNAL bind", "dn", bindDN.String(), "subject", cert.Subject.String())
+	return bindDN, true
+}
+
+// handleStartTLS starts TLS on the connection of r, as described in
+// [RFC 4511, section 4.14]. The response is sent before the TLS handshake,
+// without TLS.
+//
+// [RFC 4511, section 4.14]: https://datatracker.ietf.org/doc/html/rfc4511#section-4.14
+func (l *listener) handleStartTLS(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewExtendedResponse(gldap.WithResponseCode(gldap.ResultOperationsError))
+	resp.SetResponseName(gldap.ExtendedOperationStartTLS)
+
+	if usesTLS(r) {
+		slog.Error("StartTLS on a connection with TLS")
+		resp.SetDiagnosticMessage("TLS is already in use")
+		w.Write(resp) //nolint:errcheck,gosec // not much to do if it fails
+		return
+	}
+	resp.SetResultCode(gldap.ResultSuccess)
+	if err := w.Write(resp); err != nil {
+		slog.Error("Failed to write StartTLS response", "error", err.Error())
+		return
+	}
+	if err := r.StartTLS(l.TLSConfig); err != nil {
+		slog.Error("StartTLS failed", "error", err.Error())
+		return
+	}
+	slog.Info("StartTLS")
+}
+
+// usesTLS returns whether the connection of r uses TLS, from the start or
+// after StartTLS.
+func usesTLS(r *gldap.Request) bool {
+	_, ok := r.TLSConnectionState()
+	return ok
+}
+
+// setBindDN records dn as bound on the connection with the given ID. If dn
+// is nil, the connection is recorded as anonymous.
+func (l *listener) setBindDN(connID int, dn DN) {
+	l.bindsMu.Lock()
+	defer l.bindsMu.Unlock()
+	if dn == nil {
+		delete(l.binds, connID)
+	} else {
+		l.binds[connID] = dn
+	}
+}
+
+func (l *listener) handleClose(connID int) {
+	l.setBindDN(connID, nil)
+}
+
+// canWrite returns whether the connection of r is bound as one of the
+// Writers.
+func (l *listener) canWrite(r *gldap.Request) bool {
+	l.bindsMu.Lock()
+	dn, ok := l.binds[r.ConnectionID()]
+	l.bindsMu.Unlock()
+	return ok && slices.ContainsFunc(l.Writers, dn.Equal)
+}
+
+func (l *listener) handleAdd(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationAddResponse))
+	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
+
+	m, err := r.GetAddMessage()
+	if err != nil {
+		slog.Error("Add with non-add message", "error", err.Error())
+		resp.SetResultCode(gldap.ResultProtocolError)
+		return
+	}
+	if !l.canWrite(r) {
+		slog.Error("add not permitted", "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+		return
+	}
+	dn, err := NewDN(m.DN)
+	if err != nil {
+		slog.Error("add with invalid DN", "error", err.Error(), "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+
+	e := &Entry{DN: dn, Attrs: map[string]Attr{}}
+	for _, a := range m.Attributes {
+		if err := checkAttrType(a.Type); err != nil {
+			slog.Error("add with invalid attribute", "error", err.Error(), "dn", m.DN)
+			resp.SetResultCode(gldap.ResultProtocolError)
+			resp.SetDiagnosticMessage(err.Error())
 			return
 		}
-		node := s.db.DIT.Find(bindDN)
-		if node == nil {
-			slog.Error("bind with unknown DN", "username", m.UserName)
+		if _, ok := e.GetAttr(a.Type); ok {
+			slog.Error("add with duplicate attribute", "dn", m.DN, "attr", a.Type)
+			resp.SetResultCode(gldap.ResultProtocolError)
+			resp.SetDiagnosticMessage("duplicate attribute: " + a.Type)
 			return
 		}
-		err = node.Entry.Authenticate(string(m.Password))
-		if err != nil {
-			slog.Error("bind failed", "username", m.UserName, "error", err)
+		e.AddAttr(Attr{Name: a.Type, Vals: a.Vals})
+	}
+
+	l.mu.Lock()
+	err = l.db.Add(e)
+	l.mu.Unlock()
+	setWriteResult(resp, "add", m.DN, err)
+}
+
+func (l *listener) handleModify(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationModifyResponse))
+	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
+
+	m, err := r.GetModifyMessage()
+	if err != nil {
+		slog.Error("Modify with non-modify message", "error", err.Error())
+		resp.SetResultCode(gldap.ResultProtocolError)
+		return
+	}
+	if !l.canWrite(r) {
+		slog.Error("modify not permitted", "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+		return
+	}
+	dn, err := NewDN(m.DN)
+	if err != nil {
+		slog.Error("modify with invalid DN", "error", err.Error(), "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+
+	mods := make([]Modification, len(m.Changes))
+	for i, c := range m.Changes {
+		if err := checkAttrType(c.Modification.Type); err != nil {
+			slog.Error("modify with invalid attribute", "error", err.Error(), "dn", m.DN)
+			resp.SetResultCode(gldap.ResultProtocolError)
+			resp.SetDiagnosticMessage(err.Error())
 			return
 		}
-		slog.Info("simple bind", "username", m.UserName)
-	case m.UserName == "":
-		slog.Error("invalid bind: missing username")
+		mods[i] = Modification{
+			Op:   ModOp(c.Operation),
+			Attr: Attr{Name: c.Modification.Type, Vals: c.Modification.Vals},
+		}
+	}
+
+	l.mu.Lock()
+	err = l.db.Modify(dn, mods)
+	l.mu.Unlock()
+	setWriteResult(resp, "modify", m.DN, err)
+}
+
+func (l *listener) handleDelete(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationDelResponse))
+	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
+
+	m, err := r.GetDeleteMessage()
+	if err != nil {
+		slog.Error("Delete with non-delete message", "error", err.Error())
+		resp.SetResultCode(gldap.ResultProtocolError)
 		return
-	case m.Password == "":
-		slog.Error("invalid bind: missing password")
+	}
+	if !l.canWrite(r) {
+		slog.Error("delete not permitted", "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
 		return
 	}
-	// Override InvalidCredentials set above.
-	resp.SetResultCode(gldap.ResultSuccess)
+	dn, err := NewDN(m.DN)
+	if err != nil {
+		slog.Error("delete with invalid DN", "error", err.Error(), "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+
+	l.mu.Lock()
+	err = l.db.Delete(dn)
+	l.mu.Unlock()
+	setWriteResult(resp, "delete", m.DN, err)
+}
+
+func (l *listener) handleModifyDN(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationModifyDNResponse))
+	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
+
+	m, err := r.GetModifyDNMessage()
+	if err != nil {
+		slog.Error("ModifyDN with non-modifyDN message", "error", err.Error())
+		resp.SetResultCode(gldap.ResultProtocolError)
+		return
+	}
+	if !l.canWrite(r) {
+		slog.Error("modifyDN not permitted", "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+		return
+	}
+	dn, err := NewDN(m.DN)
+	if err != nil {
+		slog.Error("modifyDN with invalid DN", "error", err.Error(), "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+	newRDN, err := ParseRDN(m.NewRDN)
+	if err != nil {
+		slog.Error("modifyDN with invalid RDN", "error", err.Error(), "dn", m.DN, "newRDN", m.NewRDN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+	var newSuperior DN
+	if m.NewSuperior != "" {
+		if newSuperior, err = NewDN(m.NewSuperior); err != nil {
+			slog.Error("modifyDN with invalid new superior", "error", err.Error(), "dn", m.DN, "newSuperior", m.NewSuperior)
+			resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+			return
+		}
+	}
+
+	l.mu.Lock()
+	err = l.db.ModifyDN(dn, newRDN, m.DeleteOldRDN, newSuperior)
+	l.mu.Unlock()
+	setWriteResult(resp, "modifyDN", m.DN, err)
+}
+
+// checkAttrType returns an error if name cannot be the type of an attribute
+// written by a client. "dn" is not an attribute type, but names the DN of
+// entries in JSON, so an attribute with that name would change the DN of the
+// entry when it is read back from a [Store].
+func checkAttrType(name string) error {
+	if strings.EqualFold(name, "dn") {
+		return fmt.Errorf("invalid attribute type: %s", name)
+	}
+	return nil
 }
 
-func (s *Server) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
+// setWriteResult sets the result of a write operation on resp from the error
+// returned by the DB, logging the outcome.
+func setWriteResult(resp interface {
+	SetResultCode(code int)
+	SetDiagnosticMessage(msg string)
+}, method, dn string, err error,
+) {
+	resp.SetResultCode(ResultCode(err))
+	if err != nil {
+		slog.Error(method+" failed", "dn", dn, "error", err.Error())
+		resp.SetDiagnosticMessage(err.Error())
+		return
+	}
+	slog.Info(method, "dn", dn)
+}
+
+func (l *listener) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
 	resp := r.NewSearchDoneResponse()
 	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
 
@@ -103,14 +561,21 @@ func (s *Server) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
 		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
 		return
 	}
-	base := s.db.DIT.Find(baseDN)
+
+	// Entries are modified in place so hold the lock while sending them.
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	base := l.db.DIT.Find(baseDN)
 	if base == nil || (baseDN.IsEmpty() && req.Scope != gldap.BaseObject) {
 		slog.Error("basedn not found", "method", "search", "basedn", baseDN.String())
 		resp.SetResultCode(gldap.ResultNoSuchObject)
 		return
 	}
 
-	f, err := Parse(req.Filter)
+	// Convert the filter from the BER of the request rather than parsing the
+	// string gldap decompiles from it, so we interpret exactly what was
+	// sent.
+	f, err := NewFilterFromBER(req.FilterPacket)
 	if err != nil {
 		slog.Error("invalid filter", "filter", req.Filter, "error", err)
 		resp.SetResultCode(gldap.ResultFilterError)
@@ -135,22 +600,19 @@ func (s *Server) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
 	// Each entry is a separate search response
 	// https://ldap.com/ldapv3-wire-protocol-reference-search/
 	for node := range nodeIter {
-		e := node.Entry
+		e := node.Entry.withOrigin()
+		if node == &l.db.DIT {
+			e = l.rootDSE()
+		}
 		if !f.Match(e) {
 			continue
 		}
 		// TODO: filter entries, attributes and values based on permissions.
 
-		attrs := maps.Keys(e.Attrs)
-		if len(req.Attributes) > 0 && req.Attributes[0] != "*" {
-			attrs = slices.Values(req.Attributes)
-		}
 		attrMap := map[string][]string{}
-		for attrName := range attrs {
-			if a, ok := e.GetAttr(attrName); ok {
-				if !a.IsSensitive() {
-					attrMap[a.Name] = If(req.TypesOnly, nil, a.Vals)
-				}
+		for _, a := range e.SelectAttrs(req.Attributes) {
+			if !a.IsSensitive() {
+				attrMap[a.Name] = If(req.TypesOnly, nil, a.Vals)
 			}
 		}
 
@@ -164,6 +626,69 @@ func (s *Server) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
 	resp.SetResultCode(gldap.ResultSuccess)
 }
 
+func (l *listener) handleCompare(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationCompareResponse))
+	defer w.Write(resp) //nolint:errcheck // not much to do if it fails
+
+	m, err := r.GetCompareMessage()
+	if err != nil {
+		slog.Error("Compare with non-compare message", "error", err.Error())
+		resp.SetResultCode(gldap.ResultProtocolError)
+		return
+	}
+	dn, err := NewDN(m.DN)
+	if err != nil {
+		slog.Error("compare with invalid DN", "error", err.Error(), "dn", m.DN)
+		resp.SetResultCode(gldap.ResultInvalidDNSyntax)
+		return
+	}
+	// Comparing would reveal sensitive values, as searching for them would.
+	if (Attr{Name: schema.attrKey(m.AttributeDesc)}).IsSensitive() {
+		slog.Error("compare of sensitive attribute", "dn", m.DN, "attr", m.AttributeDesc)
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+		return
+	}
+
+	l.mu.RLock()
+	ok, err := l.db.Compare(dn, m.AttributeDesc, m.AssertionValue)
+	l.mu.RUnlock()
+	if err != nil {
+		slog.Error("compare failed", "dn", m.DN, "attr", m.AttributeDesc, "error", err.Error())
+		resp.SetResultCode(ResultCode(err))
+		return
+	}
+	slog.Info("compare", "dn", m.DN, "attr", m.AttributeDesc, "result", ok)
+	resp.SetResultCode(If(ok, gldap.ResultCompareTrue, gldap.ResultCompareFalse))
+}
+
+// rootDSE returns the root DSE of the DIT with the attributes describing the
+// server added, as described in [RFC 4512, section 5.1]. The naming contexts
+// are computed from the DIT on each call so they reflect its current
+// contents. Attributes with no values are omitted.
+//
+// [RFC 4512, section 5.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-5.1
+func (s *Server) rootDSE() *Entry {
+	e := &Entry{DN: DN{}, Attrs: maps.Clone(s.db.DIT.Entry.Attrs)}
+	addAttr := func(name string, vals []string) {
+		if len(vals) > 0 {
+			e.AddAttr(Attr{Name: name, Vals: vals})
+		}
+	}
+	var namingContexts []string
+	for _, dn := range s.db.NamingContexts() {
+		namingContexts = append(namingContexts, dn.String())
+	}
+	addAttr("namingContexts", namingContexts)
+	addAttr("supportedLDAPVersion", []string{"3"})
+	addAttr("supportedControl", s.supportedControls)
+	addAttr("supportedExtension", s.supportedExtensions)
+	addAttr("supportedSASLMechanisms", s.supportedSASLMechanisms)
+	addAttr("supportedFeatures", []string{allOpAttrsFeature})
+	addAttr("vendorName", []string{vendorName})
+	addAttr("vendorVersion", []string{"flapjak " + version})
+	return e
+}
+
 // If is a simple ternary operator function that returns ifTrue if cond is true
 // and ifFalse if it is not. It is intended to be used only with values that
 // have no side-effects as both ifTrue and ifFalse are evaluated before being
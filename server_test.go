@@ -0,0 +1,524 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jimlambrt/gldap"
+	"github.com/matryer/is"
+)
+
+func Test_RootDSE(t *testing.T) {
+	is := is.New(t)
+	db := NewDB()
+	is.NoErr(db.AddEntries([]*Entry{{DN: MustDN(t, "dc=example,dc=com")}}))
+	s := &Server{db: db, supportedExtensions: []string{"1.3.6.1.4.1.1466.20037"}}
+
+	e := s.rootDSE()
+	is.True(e.DN.IsEmpty())
+	for name, want := range map[string][]string{
+		"objectClass":          {"top"},
+		"subschemaSubentry":    {"cn=Subschema"},
+		"namingContexts":       {"dc=example,dc=com"},
+		"supportedLDAPVersion": {"3"},
+		"supportedExtension":   {"1.3.6.1.4.1.1466.20037"},
+		"supportedFeatures":    {allOpAttrsFeature},
+		"vendorName":           {vendorName},
+		"vendorVersion":        {"flapjak " + version},
+	} {
+		a, ok := e.GetAttr(name)
+		is.True(ok) // attribute missing
+		is.Equal(want, a.Vals)
+	}
+	_, ok := e.GetAttr("supportedControl")
+	is.True(!ok) // no controls are supported, so none are listed
+
+	// The root DSE attributes are operational, returned only on request.
+	is.Equal([]Attr{{Name: "objectClass", Vals: []string{"top"}}}, e.SelectAttrs(nil))
+	is.Equal(len(e.Attrs)-1, len(e.SelectAttrs([]string{"+"}))) // all but objectClass
+
+	// The stored root DSE is not changed.
+	_, ok = db.DIT.Entry.GetAttr("namingContexts")
+	is.True(!ok)
+}
+
+// dialTestServer runs s on a free local port until the test ends and returns
+// a client connected to it.
+func dialTestServer(t *testing.T, s *Server) *ldap.Conn {
+	t.Helper()
+	is := is.New(t)
+	addr := freeAddr(t)
+	go s.Run(addr, "") //nolint:errcheck // a failure to run fails the dial
+	t.Cleanup(func() { s.Stop() })
+	waitReady(s)
+
+	conn, err := ldap.DialURL("ldap://" + addr)
+	is.NoErr(err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// freeAddr returns a local address with a port that is free to listen on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	is := is.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitReady waits up to a second for the listeners of s to be ready for
+// connections.
+func waitReady(s *Server) {
+	ready := func() bool {
+		s.listenersMu.Lock()
+		defer s.listenersMu.Unlock()
+		return len(s.listeners) > 0 && !slices.ContainsFunc(s.listeners, func(l *listener) bool { return !l.ldap.Ready() })
+	}
+	for i := 0; i < 100 && !ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_ServerCompare(t *testing.T) {
+	type testcase struct {
+		dn       string
+		attr     string
+		value    string
+		want     bool
+		wantCode uint16
+	}
+
+	db := NewDB()
+	err := db.AddEntries([]*Entry{
+		{DN: MustDN(t, "uid=alice,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass":  {"objectClass", []string{"inetOrgPerson"}},
+			"uid":          {"uid", []string{"alice"}},
+			"userpassword": {"userPassword", []string{"secret"}},
+		}},
+		{DN: MustDN(t, "cn=admins,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"groupOfNames"}},
+			"cn":          {"cn", []string{"admins"}},
+			"member":      {"member", []string{"uid=alice,ou=people,dc=example,dc=com"}},
+		}},
+	})
+	is.New(t).NoErr(err)
+	conn := dialTestServer(t, NewServer(db))
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		got, err := conn.Compare(tt.dn, tt.attr, tt.value)
+		if tt.wantCode != 0 {
+			is.True(ldap.IsErrorWithCode(err, tt.wantCode)) // unexpected result code
+			return
+		}
+		is.NoErr(err)
+		is.Equal(tt.want, got)
+	}
+
+	tests := map[string]testcase{
+		"true":              {dn: "cn=admins,dc=example,dc=com", attr: "cn", value: "ADMINS", want: true},
+		"false":             {dn: "cn=admins,dc=example,dc=com", attr: "cn", value: "users", want: false},
+		"dn value":          {dn: "cn=admins,dc=example,dc=com", attr: "member", value: "UID=alice,ou=People,dc=example,dc=com", want: true},
+		"no such object":    {dn: "cn=users,dc=example,dc=com", attr: "cn", value: "users", wantCode: ldap.LDAPResultNoSuchObject},
+		"no such attribute": {dn: "cn=admins,dc=example,dc=com", attr: "description", value: "x", wantCode: ldap.LDAPResultNoSuchAttribute},
+		"invalid dn":        {dn: "cn", attr: "cn", value: "x", wantCode: ldap.LDAPResultInvalidDNSyntax},
+		"sensitive":         {dn: "uid=alice,ou=people,dc=example,dc=com", attr: "userPassword", value: "secret", wantCode: ldap.LDAPResultInsufficientAccessRights},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_ServerWrite(t *testing.T) {
+	type testcase struct {
+		bind      string // DN to bind as, anonymous if empty
+		badRebind bool   // bind again with the wrong password
+		op        func(c *ldap.Conn) error
+		wantCode  uint16
+		check     func(is *is.I, db *DB)
+	}
+
+	const (
+		writer = "uid=writer,ou=people,dc=example,dc=com"
+		reader = "uid=reader,ou=people,dc=example,dc=com"
+		alice  = "uid=alice,ou=people,dc=example,dc=com"
+	)
+	password := hashPassword(t, "secret", "SSHA")
+
+	addBob := func(c *ldap.Conn) error {
+		req := ldap.NewAddRequest("uid=bob,ou=people,dc=example,dc=com", nil)
+		req.Attribute("objectClass", []string{"account"})
+		req.Attribute("uid", []string{"bob"})
+		return c.Add(req)
+	}
+	modifyAlice := func(c *ldap.Conn) error {
+		req := ldap.NewModifyRequest(alice, nil)
+		req.Add("description", []string{"new"})
+		req.Delete("mail", []string{"as@example.com"})
+		req.Replace("sn", []string{"Jones"})
+		return c.Modify(req)
+	}
+	deleteAdmins := func(c *ldap.Conn) error {
+		return c.Del(ldap.NewDelRequest("cn=admins,dc=example,dc=com", nil))
+	}
+	moveAlice := func(c *ldap.Conn) error {
+		return c.ModifyDN(ldap.NewModifyDNRequest(alice, "uid=alice2", true, "dc=example,dc=com"))
+	}
+	exists := func(dn string, want bool) func(is *is.I, db *DB) {
+		return func(is *is.I, db *DB) {
+			is.Equal(want, db.DIT.Find(MustDN(t, dn)) != nil) // unexpected existence of entry
+		}
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		users := []*Entry{}
+		for _, uid := range []string{"writer", "reader"} {
+			users = append(users, &Entry{
+				DN: MustDN(t, "uid="+uid+",ou=people,dc=example,dc=com"),
+				Attrs: map[string]Attr{
+					"objectclass":  {"objectClass", []string{"account", "posixAccount"}},
+					"uid":          {"uid", []string{uid}},
+					"userpassword": {"userPassword", []string{password}},
+				},
+				Origin: OriginFiles,
+			})
+		}
+		is.NoErr(db.AddEntries(users))
+		s := NewServer(db)
+		s.Writers = []DN{MustDN(t, writer)}
+		conn := dialTestServer(t, s)
+
+		if tt.bind != "" {
+			is.NoErr(conn.Bind(tt.bind, "secret"))
+		}
+		if tt.badRebind {
+			err := conn.Bind(tt.bind, "wrong")
+			is.True(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials))
+		}
+		err := tt.op(conn)
+		if tt.wantCode != 0 {
+			is.True(ldap.IsErrorWithCode(err, tt.wantCode)) // unexpected result code
+		} else {
+			is.NoErr(err)
+		}
+		if tt.check != nil {
+			tt.check(is, db)
+		}
+	}
+
+	tests := map[string]testcase{
+		"anonymous add":      {op: addBob, wantCode: ldap.LDAPResultInsufficientAccessRights, check: exists("uid=bob,ou=people,dc=example,dc=com", false)},
+		"anonymous modify":   {op: modifyAlice, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"anonymous delete":   {op: deleteAdmins, wantCode: ldap.LDAPResultInsufficientAccessRights, check: exists("cn=admins,dc=example,dc=com", true)},
+		"anonymous modifyDN": {op: moveAlice, wantCode: ldap.LDAPResultInsufficientAccessRights, check: exists(alice, true)},
+		"reader add":         {bind: reader, op: addBob, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"reader modify":      {bind: reader, op: modifyAlice, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"reader delete":      {bind: reader, op: deleteAdmins, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"reader modifyDN":    {bind: reader, op: moveAlice, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"writer rebind":      {bind: writer, badRebind: true, op: addBob, wantCode: ldap.LDAPResultInsufficientAccessRights},
+		"writer add": {bind: writer, op: addBob, check: func(is *is.I, db *DB) {
+			node := db.DIT.Find(MustDN(t, "uid=bob,ou=people,dc=example,dc=com"))
+			is.True(node != nil)
+			is.Equal(OriginLDAP, node.Entry.Origin)
+			uid, _ := node.Entry.GetAttr("uid")
+			is.Equal([]string{"bob"}, uid.Vals)
+		}},
+		"writer add exists": {bind: writer, wantCode: ldap.LDAPResultEntryAlreadyExists, op: func(c *ldap.Conn) error {
+			req := ldap.NewAddRequest(alice, nil)
+			req.Attribute("objectClass", []string{"account"})
+			return c.Add(req)
+		}},
+		"writer add dn attribute": {bind: writer, wantCode: ldap.LDAPResultProtocolError, op: func(c *ldap.Conn) error {
+			req := ldap.NewAddRequest("uid=bob,ou=people,dc=example,dc=com", nil)
+			req.Attribute("objectClass", []string{"account"})
+			req.Attribute("DN", []string{"uid=mallory,dc=example,dc=com"})
+			return c.Add(req)
+		}, check: exists("uid=mallory,dc=example,dc=com", false)},
+		"writer add no objectClass": {bind: writer, wantCode: ldap.LDAPResultObjectClassViolation, op: func(c *ldap.Conn) error {
+			req := ldap.NewAddRequest("uid=bob,ou=people,dc=example,dc=com", nil)
+			req.Attribute("uid", []string{"bob"})
+			return c.Add(req)
+		}, check: exists("uid=bob,ou=people,dc=example,dc=com", false)},
+		"writer add duplicate attribute": {bind: writer, wantCode: ldap.LDAPResultProtocolError, op: func(c *ldap.Conn) error {
+			req := ldap.NewAddRequest("uid=bob,ou=people,dc=example,dc=com", nil)
+			req.Attribute("objectClass", []string{"account"})
+			req.Attribute("uid", []string{"bob"})
+			req.Attribute("0.9.2342.19200300.100.1.1", []string{"robert"})
+			return c.Add(req)
+		}, check: exists("uid=bob,ou=people,dc=example,dc=com", false)},
+		"writer modify": {bind: writer, op: modifyAlice, check: func(is *is.I, db *DB) {
+			e := db.DIT.Find(MustDN(t, alice)).Entry
+			for name, want := range map[string][]string{
+				"description": {"new"},
+				"mail":        {"alice@example.com"},
+				"sn":          {"Jones"},
+			} {
+				a, _ := e.GetAttr(name)
+				is.Equal(want, a.Vals)
+			}
+		}},
+		"writer modify dn attribute": {bind: writer, wantCode: ldap.LDAPResultProtocolError, op: func(c *ldap.Conn) error {
+			req := ldap.NewModifyRequest(alice, nil)
+			req.Replace("dn", []string{"uid=mallory,dc=example,dc=com"})
+			return c.Modify(req)
+		}},
+		"writer delete": {bind: writer, op: deleteAdmins, check: exists("cn=admins,dc=example,dc=com", false)},
+		"writer delete non-leaf": {bind: writer, wantCode: ldap.LDAPResultNotAllowedOnNonLeaf, op: func(c *ldap.Conn) error {
+			return c.Del(ldap.NewDelRequest("ou=people,dc=example,dc=com", nil))
+		}},
+		"writer modifyDN": {bind: writer, op: moveAlice, check: func(is *is.I, db *DB) {
+			exists(alice, false)(is, db)
+			node := db.DIT.Find(MustDN(t, "uid=alice2,dc=example,dc=com"))
+			is.True(node != nil)
+			is.Equal(OriginLDAP, node.Entry.Origin)
+			uid, _ := node.Entry.GetAttr("uid")
+			is.Equal([]string{"alice2"}, uid.Vals)
+		}},
+		"writer modifyDN no such object": {bind: writer, wantCode: ldap.LDAPResultNoSuchObject, op: func(c *ldap.Conn) error {
+			return c.ModifyDN(ldap.NewModifyDNRequest("uid=bob,ou=people,dc=example,dc=com", "uid=bob2", true, ""))
+		}},
+		"writer static": {bind: writer, wantCode: ldap.LDAPResultUnwillingToPerform, op: func(c *ldap.Conn) error {
+			return c.Del(ldap.NewDelRequest("cn=static,dc=example,dc=com", nil))
+		}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_ServerLDAPS(t *testing.T) {
+	is := is.New(t)
+	cert := newTestServerCert(t)
+	s := NewServer(newWriteTestDB(t))
+	s.TLSConfig = cert.tlsConfig(t)
+	addr := freeAddr(t)
+	go s.Run("", addr) //nolint:errcheck // a failure to run fails the dial
+	t.Cleanup(func() { s.Stop() })
+	waitReady(s)
+
+	conn, err := ldap.DialURL("ldaps://"+addr, ldap.DialWithTLSConfig(&tls.Config{RootCAs: cert.pool(), MinVersion: tls.VersionTLS12}))
+	is.NoErr(err)
+	defer conn.Close()
+	ok, err := conn.Compare("cn=admins,dc=example,dc=com", "cn", "admins")
+	is.NoErr(err)
+	is.True(ok)
+
+	// Old TLS versions are refused.
+	_, err = ldap.DialURL("ldaps://"+addr, ldap.DialWithTLSConfig(&tls.Config{RootCAs: cert.pool(), MaxVersion: tls.VersionTLS11}))
+	is.True(err != nil)
+
+	// Requests without TLS are not served.
+	plain, err := ldap.DialURL("ldap://" + addr)
+	is.NoErr(err)
+	defer plain.Close()
+	_, err = plain.Compare("cn=admins,dc=example,dc=com", "cn", "admins")
+	is.True(err != nil)
+}
+
+func Test_ServerStartTLS(t *testing.T) {
+	type testcase struct {
+		ldaps        bool // connect with LDAPS
+		startTLS     bool
+		requireTLS   bool
+		wantStartTLS uint16
+		wantBind     uint16
+	}
+
+	cert := newTestServerCert(t)
+	config := cert.tlsConfig(t)
+	clientConfig := &tls.Config{RootCAs: cert.pool(), ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	const user = "uid=user,ou=people,dc=example,dc=com"
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		is.NoErr(db.Add(&Entry{DN: MustDN(t, user), Attrs: map[string]Attr{
+			"objectclass":  {"objectClass", []string{"account", "posixAccount"}},
+			"uid":          {"uid", []string{"user"}},
+			"userpassword": {"userPassword", []string{hashPassword(t, "secret", "SSHA")}},
+		}}))
+		s := NewServer(db)
+		s.TLSConfig = config
+		s.RequireTLS = tt.requireTLS
+		addr, ldapsAddr := freeAddr(t), freeAddr(t)
+		go s.Run(addr, ldapsAddr) //nolint:errcheck // a failure to run fails the dial
+		t.Cleanup(func() { s.Stop() })
+		waitReady(s)
+
+		var conn *ldap.Conn
+		var err error
+		if tt.ldaps {
+			// Dial TLS without telling the client, so that it sends StartTLS.
+			tlsConn, err := tls.Dial("tcp", ldapsAddr, clientConfig)
+			is.NoErr(err)
+			conn = ldap.NewConn(tlsConn, false)
+			conn.Start()
+		} else {
+			conn, err = ldap.DialURL("ldap://" + addr)
+			is.NoErr(err)
+		}
+		defer conn.Close()
+
+		if tt.startTLS {
+			err := conn.StartTLS(clientConfig)
+			if tt.wantStartTLS != 0 {
+				// The client stops reading responses when StartTLS fails.
+				is.True(ldap.IsErrorWithCode(err, tt.wantStartTLS)) // unexpected StartTLS result code
+				return
+			}
+			is.NoErr(err)
+		}
+		err = conn.Bind(user, "secret")
+		if tt.wantBind != 0 {
+			is.True(ldap.IsErrorWithCode(err, tt.wantBind)) // unexpected bind result code
+		} else {
+			is.NoErr(err)
+		}
+
+		// StartTLS is published in the root DSE.
+		res, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)", []string{"supportedExtension"}, nil))
+		is.NoErr(err)
+		is.Equal(1, len(res.Entries))
+		is.Equal([]string{string(gldap.ExtendedOperationStartTLS)}, res.Entries[0].GetAttributeValues("supportedExtension"))
+	}
+
+	tests := map[string]testcase{
+		"plain":                {},
+		"plain require TLS":    {requireTLS: true, wantBind: ldap.LDAPResultConfidentialityRequired},
+		"StartTLS":             {startTLS: true},
+		"StartTLS require TLS": {startTLS: true, requireTLS: true},
+		"LDAPS require TLS":    {ldaps: true, requireTLS: true},
+		"LDAPS StartTLS":       {ldaps: true, startTLS: true, wantStartTLS: ldap.LDAPResultOperationsError},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_ServerSASLExternal(t *testing.T) {
+	type testcase struct {
+		cn        string // of the client certificate, or none if empty
+		untrusted bool   // client certificate not issued by the client CA
+		plain     bool   // connect without TLS
+		startTLS  bool
+		noMapping bool
+		wantDial  bool // want the connection to fail
+		wantCode  uint16
+	}
+
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	otherCA := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newTestServerCert(t)
+	config := serverCert.tlsConfig(t)
+	config.ClientCAs = ca.pool()
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	mapping, err := NewClientCertMapping("uid={cn},ou=people,dc=example,dc=com")
+	is.New(t).NoErr(err)
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		is.NoErr(db.Add(&Entry{DN: MustDN(t, "uid=job,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"account"}},
+			"uid":         {"uid", []string{"job"}},
+		}}))
+		s := NewServer(db)
+		s.TLSConfig = config
+		s.ClientCertMapping = If(tt.noMapping, nil, mapping)
+		s.Writers = []DN{MustDN(t, "uid=job,ou=people,dc=example,dc=com")}
+		addr, ldapsAddr := freeAddr(t), freeAddr(t)
+		go s.Run(addr, ldapsAddr) //nolint:errcheck // a failure to run fails the dial
+		t.Cleanup(func() { s.Stop() })
+		waitReady(s)
+
+		clientConfig := &tls.Config{RootCAs: serverCert.pool(), ServerName: "localhost", MinVersion: tls.VersionTLS12}
+		if tt.cn != "" {
+			client := newTestCert(t, &x509.Certificate{
+				Subject:     pkix.Name{CommonName: tt.cn},
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}, If(tt.untrusted, otherCA, ca))
+			// Send the certificate even if the server would not accept its
+			// issuer.
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &tls.Certificate{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}, nil
+			}
+		}
+		url := If(tt.plain || tt.startTLS, "ldap://"+addr, "ldaps://"+ldapsAddr)
+		conn, err := ldap.DialURL(url, ldap.DialWithTLSConfig(clientConfig))
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		if err == nil && tt.startTLS {
+			err = conn.StartTLS(clientConfig)
+		}
+		var res *ldap.SearchResult
+		if err == nil {
+			// TLS 1.3 clients only learn that their certificate was
+			// rejected when reading from the connection.
+			res, err = conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+				"(objectClass=*)", []string{"supportedSASLMechanisms"}, nil))
+		}
+		if tt.wantDial {
+			is.True(err != nil) // connection did not fail
+			return
+		}
+		is.NoErr(err)
+		is.Equal(1, len(res.Entries))
+		is.Equal(If(tt.noMapping, []string{}, []string{"EXTERNAL"}), res.Entries[0].GetAttributeValues("supportedSASLMechanisms"))
+
+		err = conn.ExternalBind()
+		if tt.wantCode != 0 {
+			is.True(ldap.IsErrorWithCode(err, tt.wantCode)) // unexpected result code
+			return
+		}
+		is.NoErr(err)
+		// Bound as the writer that the certificate maps to.
+		is.NoErr(conn.Del(ldap.NewDelRequest("cn=admins,dc=example,dc=com", nil)))
+	}
+
+	tests := map[string]testcase{
+		"LDAPS":               {cn: "job"},
+		"StartTLS":            {cn: "job", startTLS: true},
+		"no client cert":      {wantCode: ldap.LDAPResultInappropriateAuthentication},
+		"plain":               {plain: true, wantCode: ldap.LDAPResultInappropriateAuthentication},
+		"unknown entry":       {cn: "nobody", wantCode: ldap.LDAPResultInvalidCredentials},
+		"untrusted CA":        {cn: "job", untrusted: true, wantDial: true},
+		"no mapping":          {cn: "job", noMapping: true, wantCode: ldap.LDAPResultAuthMethodNotSupported},
+		"escaped certificate": {cn: "job,ou=people", wantCode: ldap.LDAPResultInvalidCredentials},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_ServerRun_Invalid(t *testing.T) {
+	is := is.New(t)
+	s := NewServer(NewDB())
+	is.True(s.Run("", "") != nil)            // no addresses
+	is.True(s.Run("", "127.0.0.1:0") != nil) // LDAPS without TLS config
+}
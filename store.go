@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jimlambrt/gldap"
+)
+
+// Change is a change to the entries of a [DB] saved in a [Store]. If Entry is
+// nil, the entry with the DN is deleted. Otherwise Entry is added, replacing
+// any entry with the DN.
+type Change struct {
+	DN    DN
+	Entry *Entry
+}
+
+// Store is durable storage for the changes made to a [DB] after it is
+// loaded, so they can be applied again to the DB loaded on a later start.
+// Only the last change to each DN needs to be kept.
+type Store interface {
+	// Load returns the last change saved for each DN, in no particular
+	// order.
+	Load() ([]Change, error)
+	// Save saves changes, in order. Either all of them are saved or none
+	// are.
+	Save(changes ...Change) error
+	// Close closes the store. It cannot be used after it is closed.
+	Close() error
+}
+
+const (
+	journalFile  = "journal.jsonl"
+	snapshotFile = "snapshot.json"
+
+	// DefaultSnapshotInterval is the default number of saves between
+	// snapshots of a [FileStore].
+	DefaultSnapshotInterval = 1000
+)
+
+// FileStore is a [Store] that keeps changes in files in a directory. Each
+// save is appended to a journal as a single line. Every SnapshotInterval
+// saves, the last change for each DN is written to a snapshot file and the
+// journal is emptied. On opening, the journal is replayed over the snapshot.
+//
+// A FileStore is not safe for concurrent use.
+type FileStore struct {
+	// SnapshotInterval is the number of saves to the journal after which a
+	// snapshot is written.
+	SnapshotInterval int
+
+	dir     string
+	journal journalWriter
+	saves   int
+	// changes holds the last change for each DN, keyed by its normalised
+	// DN, in the form it is written to the files.
+	changes map[string]storedChange
+}
+
+// journalWriter is the file a [FileStore] appends its journal to. It is an
+// *os.File except in tests that simulate failures to write it.
+type journalWriter interface {
+	io.WriteSeeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// storedChange is a [Change] as it is written to the files of a [FileStore].
+type storedChange struct {
+	DN    string          `json:"dn"`
+	Entry json.RawMessage `json:"entry,omitempty"`
+}
+
+// NewFileStore returns a FileStore using the files in dir, creating dir if
+// it does not exist. The changes in the snapshot and journal are read, and
+// any incomplete save at the end of the journal, such as from a crash while
+// writing it, is discarded.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create store directory: %w", err)
+	}
+	fs := &FileStore{
+		SnapshotInterval: DefaultSnapshotInterval,
+		dir:              dir,
+		changes:          map[string]storedChange{},
+	}
+	if err := fs.readSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.readJournal(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) readSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read snapshot: %w", err)
+	}
+	var changes []storedChange
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return fmt.Errorf("could not read snapshot: %w", err)
+	}
+	return fs.record(changes)
+}
+
+// readJournal reads the journal and opens it for appending. It is truncated
+// after the last complete line that can be read.
+func (fs *FileStore) readJournal() error {
+	f, err := os.OpenFile(filepath.Join(fs.dir, journalFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open journal: %w", err)
+	}
+	var end int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			f.Close()
+			return fmt.Errorf("could not read journal: %w", err)
+		}
+		var changes []storedChange
+		if err := json.Unmarshal(line, &changes); err != nil {
+			f.Close()
+			return fmt.Errorf("could not read journal at offset %d: %w", end, err)
+		}
+		if err := fs.record(changes); err != nil {
+			f.Close()
+			return err
+		}
+		end += int64(len(line))
+		fs.saves++
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return fmt.Errorf("could not truncate journal: %w", err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("could not seek journal: %w", err)
+	}
+	fs.journal = f
+	return nil
+}
+
+// record records changes as the last change for their DNs.
+func (fs *FileStore) record(changes []storedChange) error {
+	for _, c := range changes {
+		dn, err := NewDN(c.DN)
+		if err != nil {
+			return fmt.Errorf("invalid stored DN: %w", err)
+		}
+		fs.changes[dn.Normalize().String()] = c
+	}
+	return nil
+}
+
+// Load returns the last change saved for each DN, ordered by their
+// normalised DNs. A change whose entry is not valid, as [NewEntryFromMap]
+// checks, is logged and left out rather than failing the whole load.
+func (fs *FileStore) Load() ([]Change, error) {
+	keys := slices.Sorted(maps.Keys(fs.changes))
+	changes := make([]Change, 0, len(keys))
+	for _, k := range keys {
+		sc := fs.changes[k]
+		c := Change{}
+		var err error
+		if c.DN, err = NewDN(sc.DN); err != nil {
+			return nil, fmt.Errorf("invalid stored DN: %w", err)
+		}
+		if sc.Entry != nil {
+			if c.Entry, err = decodeStoredEntry(sc.Entry); err != nil {
+				slog.Error("invalid stored entry skipped", "dn", sc.DN, "error", err.Error())
+				continue
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// decodeStoredEntry returns the entry encoded in data by [FileStore.Save].
+func decodeStoredEntry(data []byte) (*Entry, error) {
+	var attrs map[string]any
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return nil, err
+	}
+	return NewEntryFromMap(attrs)
+}
+
+// Save appends changes to the journal as a single line and syncs it to
+// disk. If that fails, the journal is truncated to remove any part of the
+// line that was written. An entry that could not be read back by
+// [FileStore.Load] is an error, and nothing is saved. A snapshot is written
+// if SnapshotInterval saves have been made since the last one. The changes
+// are saved once the journal is synced, so a failure to write the snapshot
+// is logged rather than returned, and the snapshot is tried again on the
+// next save.
+func (fs *FileStore) Save(changes ...Change) error {
+	scs := make([]storedChange, len(changes))
+	for i, c := range changes {
+		scs[i].DN = c.DN.String()
+		if c.Entry != nil {
+			data, err := json.Marshal(c.Entry)
+			if err != nil {
+				return fmt.Errorf("could not encode entry %s: %w", c.DN, err)
+			}
+			if _, err := decodeStoredEntry(data); err != nil {
+				return fmt.Errorf("invalid entry %s: %w", c.DN, err)
+			}
+			scs[i].Entry = data
+		}
+	}
+	line, err := json.Marshal(scs)
+	if err != nil {
+		return fmt.Errorf("could not encode changes: %w", err)
+	}
+	if err := fs.appendJournal(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := fs.record(scs); err != nil {
+		return err
+	}
+	fs.saves++
+	if fs.saves >= fs.SnapshotInterval {
+		if err := fs.Snapshot(); err != nil {
+			slog.Error("could not write snapshot", "dir", fs.dir, "error", err.Error())
+		}
+	}
+	return nil
+}
+
+// appendJournal writes line to the end of the journal and syncs it. If
+// either fails, the journal is truncated back to its previous end so a
+// partly written line does not corrupt the lines written after it.
+func (fs *FileStore) appendJournal(line []byte) error {
+	end, err := fs.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("could not seek journal: %w", err)
+	}
+	_, err = fs.journal.Write(line)
+	if err != nil {
+		err = fmt.Errorf("could not write journal: %w", err)
+	} else if err = fs.journal.Sync(); err != nil {
+		err = fmt.Errorf("could not sync journal: %w", err)
+	}
+	if err == nil {
+		return nil
+	}
+	if terr := fs.journal.Truncate(end); terr != nil {
+		return errors.Join(err, fmt.Errorf("could not truncate journal: %w", terr))
+	}
+	if _, serr := fs.journal.Seek(end, io.SeekStart); serr != nil {
+		return errors.Join(err, fmt.Errorf("could not seek journal: %w", serr))
+	}
+	return err
+}
+
+// Snapshot writes the last change for each DN to the snapshot file and
+// empties the journal. The snapshot is written to a temporary file which
+// replaces the old snapshot once it is complete, so a crash while writing it
+// leaves the old snapshot and the journal to be read on the next start.
+func (fs *FileStore) Snapshot() error {
+	keys := slices.Sorted(maps.Keys(fs.changes))
+	changes := make([]storedChange, len(keys))
+	for i, k := range keys {
+		changes[i] = fs.changes[k]
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(fs.dir, snapshotFile+".*")
+	if err != nil {
+		return fmt.Errorf("could not create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // fails once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(fs.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("could not replace snapshot: %w", err)
+	}
+
+	// Replaying the journal over the new snapshot would give the same
+	// changes, so a crash before it is emptied loses nothing.
+	if err := fs.journal.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate journal: %w", err)
+	}
+	if _, err := fs.journal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek journal: %w", err)
+	}
+	fs.saves = 0
+	return nil
+}
+
+// Close closes the journal.
+func (fs *FileStore) Close() error {
+	return fs.journal.Close()
+}
+
+// LoadStore applies the changes loaded from db.Store to the DB, overlaying
+// them on the entries already in it. The entries of the changes have the
+// origin [OriginLDAP], so they replace entries of lower precedence and are
+// ignored for entries of higher precedence, as with [DB.AddEntries].
+//
+// Entries are deleted first, deepest first. Deleting an entry that does not
+// exist or that has a higher precedence does nothing. The entries are then
+// added with AddEntries one at a time, shallowest first. A change that cannot
+// be applied, such as an entry that is not valid against the schema, is
+// logged and skipped, so one bad change does not stop the server from
+// starting. An error is returned only if the changes cannot be loaded.
+func (db *DB) LoadStore() error {
+	if db.Store == nil {
+		return nil
+	}
+	changes, err := db.Store.Load()
+	if err != nil {
+		return fmt.Errorf("could not load store: %w", err)
+	}
+	slices.SortStableFunc(changes, func(a, b Change) int {
+		return len(b.DN) - len(a.DN)
+	})
+
+	var added []*Entry
+	for _, c := range changes {
+		if c.Entry != nil {
+			c.Entry.Origin = OriginLDAP
+			added = append(added, c.Entry)
+		} else if err := db.loadDelete(c.DN); err != nil {
+			slog.Error("stored change skipped", "dn", c.DN.String(), "error", err.Error())
+		}
+	}
+	slices.SortStableFunc(added, func(a, b *Entry) int {
+		return len(a.DN) - len(b.DN)
+	})
+	for _, e := range added {
+		if err := db.AddEntries([]*Entry{e}); err != nil {
+			slog.Error("stored change skipped", "dn", e.DN.String(), "error", err.Error())
+		}
+	}
+	return nil
+}
+
+// loadDelete deletes the entry with the given DN for [DB.LoadStore], if it
+// exists and does not have a higher precedence than [OriginLDAP].
+func (db *DB) loadDelete(dn DN) error {
+	node := db.DIT.Find(dn)
+	if node == nil {
+		return nil
+	}
+	if origin := node.Entry.Origin; origin.Precedence() > OriginLDAP.Precedence() {
+		slog.Info("stored delete ignored for entry of higher precedence", "dn", dn.String(), "kept", origin.String())
+		return nil
+	}
+	if len(node.children) > 0 {
+		children := make([]string, len(node.children))
+		for i, c := range node.children {
+			children[i] = c.Entry.DN.String()
+		}
+		return fmt.Errorf("%w: cannot delete %s with children %s",
+			LDAPError(gldap.ResultNotAllowedOnNonLeaf), dn, strings.Join(children, "; "))
+	}
+	db.DIT.remove(node)
+	return nil
+}
+
+// save saves changes to db.Store, if the DB has one.
+func (db *DB) save(changes ...Change) error {
+	if db.Store == nil {
+		return nil
+	}
+	if err := db.Store.Save(changes...); err != nil {
+		return fmt.Errorf("could not save changes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func mustFileStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+	fs, err := NewFileStore(dir)
+	is.New(t).NoErr(err)
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+func Test_FileStore(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	bob := &Entry{DN: MustDN(t, "uid=bob,dc=example,dc=com"), Attrs: map[string]Attr{
+		"objectclass": {"objectClass", []string{"account"}},
+		"uid":         {"uid", []string{"bob"}},
+	}}
+	carol := &Entry{DN: MustDN(t, "uid=carol,dc=example,dc=com"), Attrs: map[string]Attr{
+		"objectclass": {"objectClass", []string{"account"}},
+		"uid":         {"uid", []string{"carol"}},
+	}}
+
+	fs := mustFileStore(t, dir)
+	is.NoErr(fs.Save(Change{DN: bob.DN, Entry: bob}))
+	is.NoErr(fs.Save(Change{DN: carol.DN, Entry: carol}))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "UID=Bob,dc=example,dc=com")}))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=alice,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	want := []Change{
+		{DN: MustDN(t, "uid=alice,dc=example,dc=com")},
+		{DN: MustDN(t, "UID=Bob,dc=example,dc=com")},
+		{DN: carol.DN, Entry: carol},
+	}
+
+	fs = mustFileStore(t, dir)
+	got, err := fs.Load()
+	is.NoErr(err)
+	is.Equal(want, got)
+
+	// Loading from the snapshot gives the same changes.
+	is.NoErr(fs.Snapshot())
+	is.NoErr(fs.Close())
+	journal, err := os.ReadFile(filepath.Join(dir, journalFile))
+	is.NoErr(err)
+	is.Equal(0, len(journal))
+	fs = mustFileStore(t, dir)
+	got, err = fs.Load()
+	is.NoErr(err)
+	is.Equal(want, got)
+}
+
+func Test_FileStore_SnapshotInterval(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	fs.SnapshotInterval = 2
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=alice,dc=example,dc=com")}))
+	_, err := os.Stat(filepath.Join(dir, snapshotFile))
+	is.True(os.IsNotExist(err))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=bob,dc=example,dc=com")}))
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	is.NoErr(err)
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=carol,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	fs = mustFileStore(t, dir)
+	got, err := fs.Load()
+	is.NoErr(err)
+	is.Equal(3, len(got))
+}
+
+func Test_FileStore_IncompleteJournal(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=alice,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	// Simulate a crash part way through writing a save.
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0)
+	is.NoErr(err)
+	_, err = f.WriteString(`[{"dn":"uid=bob,dc=exam`)
+	is.NoErr(err)
+	is.NoErr(f.Close())
+
+	fs = mustFileStore(t, dir)
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=carol,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	fs = mustFileStore(t, dir)
+	got, err := fs.Load()
+	is.NoErr(err)
+	is.Equal([]Change{
+		{DN: MustDN(t, "uid=alice,dc=example,dc=com")},
+		{DN: MustDN(t, "uid=carol,dc=example,dc=com")},
+	}, got)
+}
+
+func Test_FileStore_InvalidEntry(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	noObjectClass := &Entry{DN: MustDN(t, "uid=bob,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+		"uid": {"uid", []string{"bob"}},
+	}}
+	err := fs.Save(Change{DN: noObjectClass.DN, Entry: noObjectClass})
+	is.True(err != nil) // entry without objectClass saved
+	is.NoErr(fs.Close())
+
+	// A journal written before entries were checked may still have one.
+	journal := `[{"dn":"uid=bob,ou=people,dc=example,dc=com","entry":{"dn":"uid=bob,ou=people,dc=example,dc=com","uid":["bob"]}}]
+[{"dn":"uid=carol,ou=people,dc=example,dc=com","entry":{"dn":"uid=carol,ou=people,dc=example,dc=com","objectClass":["account"],"uid":["carol"]}}]
+`
+	is.NoErr(os.WriteFile(filepath.Join(dir, journalFile), []byte(journal), 0o600))
+
+	db := newWriteTestDB(t)
+	db.Store = mustFileStore(t, dir)
+	is.NoErr(db.LoadStore())
+	is.Equal(nil, db.DIT.Find(MustDN(t, "uid=bob,ou=people,dc=example,dc=com")))
+	is.True(db.DIT.Find(MustDN(t, "uid=carol,ou=people,dc=example,dc=com")) != nil)
+}
+
+func Test_DBLoadStore(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	db := newWriteTestDB(t)
+	db.Store = mustFileStore(t, dir)
+	bob, err := NewEntryFromMap(map[string]any{
+		"dn": "uid=bob,ou=groups,ou=people,dc=example,dc=com", "objectClass": "account",
+	})
+	is.NoErr(err)
+	is.NoErr(db.Add(&Entry{DN: MustDN(t, "ou=groups,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+		"objectclass": {"objectClass", []string{"organizationalUnit"}},
+	}}))
+	is.NoErr(db.Add(bob))
+	is.NoErr(db.Delete(MustDN(t, "cn=admins,dc=example,dc=com")))
+	is.NoErr(db.Modify(MustDN(t, "uid=alice,ou=people,dc=example,dc=com"), []Modification{
+		{Op: ModReplace, Attr: Attr{Name: "mail", Vals: []string{"a@example.com"}}},
+	}))
+	is.NoErr(db.ModifyDN(MustDN(t, "uid=alice,ou=people,dc=example,dc=com"), RDN{{Name: "uid", Value: "alice2"}}, true, nil))
+	is.NoErr(db.Store.Close())
+	want := db.DIT.String()
+
+	// A fresh DB with the same base entries and the stored changes applied
+	// has the same entries.
+	db = newWriteTestDB(t)
+	db.Store = mustFileStore(t, dir)
+	is.NoErr(db.LoadStore())
+	is.Equal(want, db.DIT.String())
+	alice := db.DIT.Find(MustDN(t, "uid=alice2,ou=people,dc=example,dc=com"))
+	is.True(alice != nil)
+	mail, _ := alice.Entry.GetAttr("mail")
+	is.Equal([]string{"a@example.com"}, mail.Vals)
+}
+
+func Test_DBLoadStore_Conflict(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "ou=people,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	// The base entries now have a child of the deleted entry, so the delete
+	// is skipped.
+	db := newWriteTestDB(t)
+	want := db.DIT.String()
+	db.Store = mustFileStore(t, dir)
+	is.NoErr(db.LoadStore())
+	is.Equal(want, db.DIT.String())
+}
+
+func Test_DBLoadStore_Static(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	// Changes to entries that are static on the next start are ignored.
+	fs := mustFileStore(t, dir)
+	static := &Entry{DN: MustDN(t, "cn=static,dc=example,dc=com"), Attrs: map[string]Attr{
+		"objectclass": {"objectClass", []string{"applicationProcess"}},
+		"cn":          {"cn", []string{"static"}},
+		"description": {"description", []string{"modified"}},
+	}}
+	is.NoErr(fs.Save(Change{DN: static.DN, Entry: static}))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	db := newWriteTestDB(t)
+	want := db.DIT.String()
+	db.Store = mustFileStore(t, dir)
+	is.NoErr(db.LoadStore())
+	is.Equal(want, db.DIT.String())
+	node := db.DIT.Find(static.DN)
+	is.Equal(OriginStatic, node.Entry.Origin)
+	_, ok := node.Entry.GetAttr("description")
+	is.True(!ok)
+}
+
+// failingJournal is a journalWriter that fails to write or sync when told to.
+// A failed write writes half of the data first, as a full disk might.
+type failingJournal struct {
+	*os.File
+	failWrite bool
+	failSync  bool
+}
+
+func (j *failingJournal) Write(p []byte) (int, error) {
+	if j.failWrite {
+		n, _ := j.File.Write(p[:len(p)/2])
+		return n, errors.New("write failed")
+	}
+	return j.File.Write(p)
+}
+
+func (j *failingJournal) Sync() error {
+	if j.failSync {
+		return errors.New("sync failed")
+	}
+	return j.File.Sync()
+}
+
+func Test_FileStore_FailedSave(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	journal := &failingJournal{File: fs.journal.(*os.File)} //nolint:forcetypeassert // always a file
+	fs.journal = journal
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=alice,dc=example,dc=com")}))
+	journal.failWrite = true
+	is.True(fs.Save(Change{DN: MustDN(t, "uid=bob,dc=example,dc=com")}) != nil)
+	journal.failWrite, journal.failSync = false, true
+	is.True(fs.Save(Change{DN: MustDN(t, "uid=carol,dc=example,dc=com")}) != nil)
+	journal.failSync = false
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=dave,dc=example,dc=com")}))
+	is.NoErr(fs.Close())
+
+	// The failed saves leave nothing in the journal.
+	fs = mustFileStore(t, dir)
+	got, err := fs.Load()
+	is.NoErr(err)
+	is.Equal([]Change{
+		{DN: MustDN(t, "uid=alice,dc=example,dc=com")},
+		{DN: MustDN(t, "uid=dave,dc=example,dc=com")},
+	}, got)
+}
+
+func Test_FileStore_FailedSnapshot(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	fs := mustFileStore(t, dir)
+	fs.SnapshotInterval = 1
+	// A directory in the way of the snapshot makes writing it fail.
+	is.NoErr(os.Mkdir(filepath.Join(dir, snapshotFile), 0o700))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=alice,dc=example,dc=com")}))
+	is.NoErr(os.Remove(filepath.Join(dir, snapshotFile)))
+	is.NoErr(fs.Save(Change{DN: MustDN(t, "uid=bob,dc=example,dc=com")}))
+	_, err := os.Stat(filepath.Join(dir, snapshotFile))
+	is.NoErr(err)
+	is.NoErr(fs.Close())
+
+	fs = mustFileStore(t, dir)
+	got, err := fs.Load()
+	is.NoErr(err)
+	is.Equal(2, len(got))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+)
+
+// SubschemaEntry returns the subschema subentry for the schema, as described
+// by [RFC 4512, section 4.2], with the given DN. It holds the descriptions of
+// all the syntaxes, matching rules, attribute types and object classes of the
+// schema so that clients can discover them. All matching rules are
+// described, not just those used by the schema, as they can all be used in
+// extensible match filters.
+//
+// [RFC 4512, section 4.2]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.2
+func (s *Schema) SubschemaEntry(dn DN) *Entry {
+	e := &Entry{DN: dn, Attrs: map[string]Attr{}}
+	e.AddAttr(Attr{Name: "objectClass", Vals: []string{"top", "subschema", "extensibleObject"}})
+	for _, ava := range dn[len(dn)-1] {
+		e.AddAttr(Attr{Name: ava.Name, Vals: []string{ava.Value}})
+	}
+
+	addDescs := func(name string, n int, desc func(i int) string) {
+		vals := make([]string, n)
+		for i := range n {
+			vals[i] = desc(i)
+		}
+		e.AddAttr(Attr{Name: name, Vals: vals})
+	}
+	addDescs("ldapSyntaxes", len(s.ldapSyntaxes), func(i int) string { return s.ldapSyntaxes[i].String() })
+	addDescs("matchingRules", len(matchingRuleList), func(i int) string { return matchingRuleList[i].String() })
+	addDescs("attributeTypes", len(s.attributeTypes), func(i int) string { return s.attributeTypes[i].String() })
+	addDescs("objectClasses", len(s.objectClasses), func(i int) string { return s.objectClasses[i].String() })
+	return e
+}
+
+// String returns the AttributeTypeDescription of the attribute type. It is
+// the inverse of [ParseAttributeType].
+func (at *AttributeType) String() string {
+	d := newDescBuilder(at.OID)
+	d.qdescrs("NAME", at.Names)
+	d.qdstring("DESC", at.Desc)
+	d.flag("OBSOLETE", at.Obsolete)
+	d.word("SUP", at.Sup)
+	d.word("EQUALITY", at.Equality)
+	d.word("ORDERING", at.Ordering)
+	d.word("SUBSTR", at.Substr)
+	d.word("SYNTAX", at.Syntax)
+	d.flag("SINGLE-VALUE", at.SingleValue)
+	d.flag("COLLECTIVE", at.Collective)
+	d.flag("NO-USER-MODIFICATION", at.NoUserModification)
+	d.word("USAGE", If(at.Usage == "userApplications", "", at.Usage))
+	return d.String()
+}
+
+// String returns the ObjectClassDescription of the object class. It is the
+// inverse of [ParseObjectClass].
+func (oc *ObjectClass) String() string {
+	d := newDescBuilder(oc.OID)
+	d.qdescrs("NAME", oc.Names)
+	d.qdstring("DESC", oc.Desc)
+	d.flag("OBSOLETE", oc.Obsolete)
+	d.oids("SUP", oc.Sup)
+	d.flag(oc.Kind.String(), true)
+	d.oids("MUST", oc.Must)
+	d.oids("MAY", oc.May)
+	return d.String()
+}
+
+// String returns the SyntaxDescription of the syntax. It is the inverse of
+// [ParseLDAPSyntax].
+func (syn *LDAPSyntax) String() string {
+	d := newDescBuilder(syn.OID)
+	d.qdstring("DESC", syn.Desc)
+	return d.String()
+}
+
+// String returns the MatchingRuleDescription of the matching rule, as
+// described by [RFC 4512, section 4.1.3].
+//
+// [RFC 4512, section 4.1.3]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1.3
+func (mr *MatchingRule) String() string {
+	d := newDescBuilder(mr.OID)
+	d.qdescrs("NAME", []string{mr.Name})
+	d.word("SYNTAX", mr.Syntax)
+	return d.String()
+}
+
+// descBuilder builds the string form of a schema element description. Fields
+// with empty values are omitted.
+type descBuilder struct {
+	strings.Builder
+}
+
+func newDescBuilder(oid string) *descBuilder {
+	d := &descBuilder{}
+	d.WriteString("( " + oid)
+	return d
+}
+
+// String returns the description, closing its parentheses.
+func (d *descBuilder) String() string {
+	return d.Builder.String() + " )"
+}
+
+func (d *descBuilder) flag(keyword string, set bool) {
+	if set {
+		d.WriteString(" " + keyword)
+	}
+}
+
+func (d *descBuilder) word(keyword, val string) {
+	if val != "" {
+		d.WriteString(" " + keyword + " " + val)
+	}
+}
+
+func (d *descBuilder) qdstring(keyword, val string) {
+	if val != "" {
+		d.WriteString(" " + keyword + " " + quoteDescString(val))
+	}
+}
+
+// qdescrs writes a single quoted name, or a parenthesised list of them.
+func (d *descBuilder) qdescrs(keyword string, vals []string) {
+	quoted := make([]string, len(vals))
+	for i, v := range vals {
+		quoted[i] = quoteDescString(v)
+	}
+	d.list(keyword, quoted, " ")
+}
+
+// oids writes a single OID or name, or a parenthesised list of them separated
+// by dollars.
+func (d *descBuilder) oids(keyword string, vals []string) {
+	d.list(keyword, vals, " $ ")
+}
+
+func (d *descBuilder) list(keyword string, vals []string, sep string) {
+	switch len(vals) {
+	case 0:
+	case 1:
+		d.WriteString(" " + keyword + " " + vals[0])
+	default:
+		d.WriteString(" " + keyword + " ( " + strings.Join(vals, sep) + " )")
+	}
+}
+
+// quoteDescString quotes s as a qdstring, escaping the characters that cannot
+// appear in one, as described in [RFC 4512, section 4.1].
+//
+// [RFC 4512, section 4.1]: https://datatracker.ietf.org/doc/html/rfc4512#section-4.1
+func quoteDescString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\5C`, "'", `\27`).Replace(s) + "'"
+}
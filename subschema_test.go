@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_SchemaDesc_RoundTrip(t *testing.T) {
+	for _, desc := range builtinAttributeTypes {
+		t.Run(desc, func(t *testing.T) {
+			is := is.New(t)
+			at, err := ParseAttributeType(desc)
+			is.NoErr(err)
+			is.Equal(desc, at.String())
+		})
+	}
+	for _, desc := range builtinObjectClasses {
+		t.Run(desc, func(t *testing.T) {
+			is := is.New(t)
+			oc, err := ParseObjectClass(desc)
+			is.NoErr(err)
+			is.Equal(desc, oc.String())
+		})
+	}
+	for _, desc := range builtinLDAPSyntaxes {
+		t.Run(desc, func(t *testing.T) {
+			is := is.New(t)
+			syn, err := ParseLDAPSyntax(desc)
+			is.NoErr(err)
+			is.Equal(desc, syn.String())
+		})
+	}
+}
+
+func Test_SchemaDesc_Quoting(t *testing.T) {
+	is := is.New(t)
+	at := &AttributeType{OID: "1.2.3", Names: []string{"a", "b"}, Desc: `it's a \`, Syntax: "1.2"}
+	desc := at.String()
+	is.Equal(`( 1.2.3 NAME ( 'a' 'b' ) DESC 'it\27s a \5C' SYNTAX 1.2 )`, desc)
+	parsed, err := ParseAttributeType(desc)
+	is.NoErr(err)
+	is.Equal(at, parsed)
+}
+
+func Test_MatchingRule_String(t *testing.T) {
+	is := is.New(t)
+	mr := LookupMatchingRule("caseIgnoreMatch")
+	is.Equal("( 2.5.13.2 NAME 'caseIgnoreMatch' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )", mr.String())
+}
+
+func Test_SubschemaEntry(t *testing.T) {
+	is := is.New(t)
+	db := NewDB()
+
+	dse := db.DIT.Find(DN{})
+	a, ok := dse.Entry.GetAttr("subschemaSubentry")
+	is.True(ok)
+	is.Equal([]string{"cn=Subschema"}, a.Vals)
+
+	node := db.DIT.Find(MustDN(t, "cn=subschema"))
+	is.True(node != nil)
+	e := node.Entry
+
+	a, ok = e.GetAttr("objectClass")
+	is.True(ok)
+	is.True(a.HasValue("subschema"))
+
+	a, ok = e.GetAttr("attributeTypes")
+	is.True(ok)
+	is.Equal(len(builtinAttributeTypes), len(a.Vals))
+	is.True(a.HasValue("( 1.3.6.1.1.1.1.0 NAME 'uidNumber' EQUALITY integerMatch ORDERING integerOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 SINGLE-VALUE )"))
+	// objectIdentifierFirstComponentMatch matches on the OID alone.
+	is.True(a.HasValue("1.3.6.1.1.1.1.33"))
+
+	a, ok = e.GetAttr("objectClasses")
+	is.True(ok)
+	is.Equal(len(builtinObjectClasses), len(a.Vals))
+	is.True(a.HasValue("1.3.6.1.1.1.2.16")) // automountMap
+
+	a, ok = e.GetAttr("matchingRules")
+	is.True(ok)
+	is.Equal(len(matchingRuleList), len(a.Vals))
+
+	a, ok = e.GetAttr("ldapSyntaxes")
+	is.True(ok)
+	is.Equal(len(builtinLDAPSyntaxes), len(a.Vals))
+
+	// The schema attributes are operational, so only returned when
+	// requested.
+	is.Equal([]string{"cn", "objectClass"}, attrNames(e.SelectAttrs(nil)))
+	is.Equal([]string{"attributeTypes", "cn", "objectClass"}, attrNames(e.SelectAttrs([]string{"*", "attributetypes"})))
+	is.Equal([]string{"attributeTypes", "ldapSyntaxes", "matchingRules", "objectClasses"}, attrNames(e.SelectAttrs([]string{"+"})))
+	is.Equal([]string{}, attrNames(e.SelectAttrs([]string{"1.1"})))
+}
+
+func attrNames(attrs []Attr) []string {
+	names := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		names = append(names, a.Name)
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Jim Lambert
+// SPDX-License-Identifier: MIT
+
+package gldap
+
+import (
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// CompareMessage is a compare request message
+type CompareMessage struct {
+	baseMessage
+	// DN identifies the entry being compared
+	DN string
+	// AttributeDesc is the attribute of the entry being compared
+	AttributeDesc string
+	// AssertionValue is the value compared with the attribute's values
+	AssertionValue string
+	// Controls hold optional controls to send with the request
+	Controls []Control
+}
+
+type compareParameters struct {
+	dn             string
+	attributeDesc  string
+	assertionValue string
+	controls       []Control
+}
+
+// compareParameters decodes the compare request parameters from the packet
+func (p *packet) compareParameters() (*compareParameters, error) {
+	const op = "gldap.(Packet).compareParameters"
+	const (
+		childDN             = 0
+		childAVA            = 1
+		childAttributeDesc  = 0
+		childAssertionValue = 1
+	)
+	var parameters compareParameters
+	requestPacket, err := p.requestPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if requestPacket.Packet.Tag != ApplicationCompareRequest {
+		return nil, fmt.Errorf("%s: not a compare request, expected tag %d and got %d: %w", op, ApplicationCompareRequest, requestPacket.Tag, ErrInvalidParameter)
+	}
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childDN)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid DN: %w", op, ErrInvalidParameter)
+	}
+	parameters.dn = requestPacket.Children[childDN].Data.String()
+
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypeConstructed, withTag(ber.TagSequence), withAssertChild(childAVA)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid attribute value assertion: %w", op, ErrInvalidParameter)
+	}
+	avaPacket := packet{Packet: requestPacket.Children[childAVA]}
+	if err := avaPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childAttributeDesc)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid attribute description: %w", op, ErrInvalidParameter)
+	}
+	parameters.attributeDesc = avaPacket.Children[childAttributeDesc].Data.String()
+	if err := avaPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childAssertionValue)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid assertion value: %w", op, ErrInvalidParameter)
+	}
+	parameters.assertionValue = avaPacket.Children[childAssertionValue].Data.String()
+
+	controlPacket, err := p.controlPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if controlPacket != nil {
+		parameters.controls = make([]Control, 0, len(controlPacket.Children))
+		for _, c := range controlPacket.Children {
+			ctrl, err := decodeControl(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			parameters.controls = append(parameters.controls, ctrl)
+		}
+	}
+	return &parameters, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Jim Lambert
+// SPDX-License-Identifier: MIT
+
+package gldap
+
+import (
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// ModifyDNMessage is a modify DN request message
+type ModifyDNMessage struct {
+	baseMessage
+	// DN identifies the entry being renamed
+	DN string
+	// NewRDN is the new RDN of the entry
+	NewRDN string
+	// DeleteOldRDN is true if the values of the old RDN are to be deleted
+	// from the entry
+	DeleteOldRDN bool
+	// NewSuperior is the DN of the new parent of the entry, or empty if the
+	// entry is not moved
+	NewSuperior string
+	// Controls hold optional controls to send with the request
+	Controls []Control
+}
+
+type modifyDNParameters struct {
+	dn           string
+	newRDN       string
+	deleteOldRDN bool
+	newSuperior  string
+	controls     []Control
+}
+
+// modifyDNParameters decodes the modify DN request parameters from the packet
+func (p *packet) modifyDNParameters() (*modifyDNParameters, error) {
+	const op = "gldap.(Packet).modifyDNParameters"
+	const (
+		childDN           = 0
+		childNewRDN       = 1
+		childDeleteOldRDN = 2
+		childNewSuperior  = 3
+	)
+	var parameters modifyDNParameters
+	requestPacket, err := p.requestPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if requestPacket.Packet.Tag != ApplicationModifyDNRequest {
+		return nil, fmt.Errorf("%s: not a modify dn request, expected tag %d and got %d: %w", op, ApplicationModifyDNRequest, requestPacket.Tag, ErrInvalidParameter)
+	}
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childDN)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid DN: %w", op, ErrInvalidParameter)
+	}
+	parameters.dn = requestPacket.Children[childDN].Data.String()
+
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childNewRDN)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid new RDN: %w", op, ErrInvalidParameter)
+	}
+	parameters.newRDN = requestPacket.Children[childNewRDN].Data.String()
+
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagBoolean), withAssertChild(childDeleteOldRDN)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid delete old RDN: %w", op, ErrInvalidParameter)
+	}
+	var ok bool
+	if parameters.deleteOldRDN, ok = requestPacket.Children[childDeleteOldRDN].Value.(bool); !ok {
+		return nil, fmt.Errorf("%s: delete old RDN is not a bool: %w", op, ErrInvalidParameter)
+	}
+
+	if len(requestPacket.Children) > childNewSuperior {
+		if err := requestPacket.assert(ber.ClassContext, ber.TypePrimitive, withTag(0), withAssertChild(childNewSuperior)); err != nil {
+			return nil, fmt.Errorf("%s: invalid new superior: %w", op, ErrInvalidParameter)
+		}
+		parameters.newSuperior = requestPacket.Children[childNewSuperior].Data.String()
+	}
+
+	controlPacket, err := p.controlPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if controlPacket != nil {
+		parameters.controls = make([]Control, 0, len(controlPacket.Children))
+		for _, c := range controlPacket.Children {
+			ctrl, err := decodeControl(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			parameters.controls = append(parameters.controls, ctrl)
+		}
+	}
+	return &parameters, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Jim Lambert
+// SPDX-License-Identifier: MIT
+
+package gldap
+
+import (
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// SASLAuthChoice specifies a SASL authentication choice for bind message
+const SASLAuthChoice AuthChoice = "sasl"
+
+// saslAuthTag is the context tag of the SASL authentication choice of a bind
+// request
+const saslAuthTag = 3
+
+// SASLBindMessage is a SASL bind request message
+type SASLBindMessage struct {
+	baseMessage
+	// AuthChoice for the request (SASLAuthChoice)
+	AuthChoice AuthChoice
+	// UserName for the bind request, which is usually empty for SASL
+	UserName string
+	// Mechanism is the name of the SASL mechanism
+	Mechanism string
+	// Credentials are the optional SASL credentials
+	Credentials []byte
+	// Controls are optional controls for the bind request
+	Controls []Control
+}
+
+type saslBindParameters struct {
+	userName    string
+	mechanism   string
+	credentials []byte
+	controls    []Control
+}
+
+// isSASLBind returns whether the packet is a bind request with the SASL
+// authentication choice
+func (p *packet) isSASLBind() bool {
+	const childAuthentication = 2
+	requestPacket, err := p.requestPacket()
+	if err != nil || requestPacket.Packet.Tag != ApplicationBindRequest {
+		return false
+	}
+	return requestPacket.assert(ber.ClassContext, ber.TypeConstructed, withTag(saslAuthTag), withAssertChild(childAuthentication)) == nil
+}
+
+// saslBindParameters decodes the SASL bind request parameters from the packet
+func (p *packet) saslBindParameters() (*saslBindParameters, error) {
+	const op = "gldap.(Packet).saslBindParameters"
+	const (
+		childUserName       = 1
+		childAuthentication = 2
+		childMechanism      = 0
+		childCredentials    = 1
+	)
+	var parameters saslBindParameters
+	requestPacket, err := p.requestPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := requestPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childUserName)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid username packet: %w", op, ErrInvalidParameter)
+	}
+	parameters.userName = requestPacket.Children[childUserName].Data.String()
+
+	if err := requestPacket.assert(ber.ClassContext, ber.TypeConstructed, withTag(saslAuthTag), withAssertChild(childAuthentication)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid SASL credentials: %w", op, ErrInvalidParameter)
+	}
+	saslPacket := packet{Packet: requestPacket.Children[childAuthentication]}
+	if err := saslPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childMechanism)); err != nil {
+		return nil, fmt.Errorf("%s: missing/invalid SASL mechanism: %w", op, ErrInvalidParameter)
+	}
+	parameters.mechanism = saslPacket.Children[childMechanism].Data.String()
+	if len(saslPacket.Children) > childCredentials {
+		if err := saslPacket.assert(ber.ClassUniversal, ber.TypePrimitive, withTag(ber.TagOctetString), withAssertChild(childCredentials)); err != nil {
+			return nil, fmt.Errorf("%s: invalid SASL credentials: %w", op, ErrInvalidParameter)
+		}
+		parameters.credentials = saslPacket.Children[childCredentials].Data.Bytes()
+	}
+
+	controlPacket, err := p.controlPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if controlPacket != nil {
+		parameters.controls = make([]Control, 0, len(controlPacket.Children))
+		for _, c := range controlPacket.Children {
+			ctrl, err := decodeControl(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			parameters.controls = append(parameters.controls, ctrl)
+		}
+	}
+	return &parameters, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// TLSReloadInterval is how often a [TLSCertificate] checks its files for a
+// new certificate.
+const TLSReloadInterval = time.Minute
+
+// TLSCertificate is a TLS certificate chain and private key loaded from PEM
+// files. It is loaded again when the files change, so that certificates
+// rotated into place, such as from a Kubernetes Secret, are used for new TLS
+// handshakes without a restart.
+type TLSCertificate struct {
+	certFile, keyFile string
+
+	cert atomic.Pointer[tls.Certificate]
+	// certPEM and keyPEM are the contents of the files that cert was loaded
+	// from, to tell when the files change.
+	certPEM, keyPEM []byte
+}
+
+// NewTLSCertificate returns a TLSCertificate loaded from the PEM files
+// certFile and keyFile.
+func NewTLSCertificate(certFile, keyFile string) (*TLSCertificate, error) {
+	c := &TLSCertificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate returns the current certificate. It is for
+// [tls.Config.GetCertificate].
+func (c *TLSCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Watch checks the files of c for a new certificate every interval until
+// ctx is done. A certificate that fails to load is logged and the current
+// one kept, as the certificate and key files may be written one after the
+// other and be checked in between.
+func (c *TLSCertificate) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.reload(); err != nil {
+				slog.Error("Could not reload TLS certificate", "error", err)
+			}
+		}
+	}
+}
+
+// reload loads the certificate from the files of c if they have changed,
+// returning whether they had.
+func (c *TLSCertificate) reload() (bool, error) {
+	certPEM, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return false, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	if bytes.Equal(certPEM, c.certPEM) && bytes.Equal(keyPEM, c.keyPEM) {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		return false, errors.New("could not load TLS certificate: no certificate")
+	}
+	c.cert.Store(&cert)
+	c.certPEM, c.keyPEM = certPEM, keyPEM
+	slog.Info("TLS certificate loaded", "file", c.certFile, "subject", cert.Leaf.Subject.String(),
+		"serial", cert.Leaf.SerialNumber.Text(16), "notAfter", cert.Leaf.NotAfter)
+	return true, nil
+}
+
+// NewTLSConfig returns a TLS configuration for serving with cert. It
+// requires TLS 1.2 or later. TLS 1.2 is limited to the cipher suites with
+// forward secrecy and authenticated encryption; the cipher suites of TLS 1.3
+// all have both and are not configurable.
+func NewTLSConfig(cert *TLSCertificate) *tls.Config {
+	return &tls.Config{
+		GetCertificate: cert.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// LoadCertPool returns a pool of the certificates in the PEM file caFile,
+// such as the CA certificates that TLS client certificates are verified
+// with.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("could not load CA certificates: no certificates in %s", caFile)
+	}
+	return pool, nil
+}
+
+// ClientCertMapping maps the certificates of TLS clients to the DNs of the
+// entries they bind as with the SASL EXTERNAL mechanism. It is a template
+// of a DN with placeholders for values from the certificate:
+//
+//   - {subject}: the subject DN
+//   - {cn}: the common name of the subject
+//   - {email}: the first email address subject alternative name
+//   - {dns}: the first DNS name subject alternative name
+//
+// All but {subject} are escaped as attribute values of the DN, so a
+// template such as "uid={cn},ou=people,dc=example,dc=com" maps a
+// certificate for "CN=backup" to "uid=backup,ou=people,dc=example,dc=com".
+type ClientCertMapping struct {
+	template string
+}
+
+// clientCertPlaceholder matches the placeholders of a [ClientCertMapping].
+var clientCertPlaceholder = regexp.MustCompile(`\{[a-z]*\}`)
+
+// clientCertValues returns the values of the placeholders of a
+// [ClientCertMapping] from a certificate, or "" if it has none.
+var clientCertValues = map[string]func(cert *x509.Certificate) string{
+	"{subject}": func(cert *x509.Certificate) string { return cert.Subject.String() },
+	"{cn}":      func(cert *x509.Certificate) string { return cert.Subject.CommonName },
+	"{email}":   func(cert *x509.Certificate) string { return first(cert.EmailAddresses) },
+	"{dns}":     func(cert *x509.Certificate) string { return first(cert.DNSNames) },
+}
+
+// NewClientCertMapping returns a ClientCertMapping with the DN template
+// tmpl, or an error if it has an unknown placeholder or is not a DN.
+func NewClientCertMapping(tmpl string) (*ClientCertMapping, error) {
+	if tmpl == "" {
+		return nil, errors.New("invalid client certificate mapping: empty DN")
+	}
+	var err error
+	dn := clientCertPlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		if _, ok := clientCertValues[p]; !ok {
+			err = fmt.Errorf("invalid client certificate mapping: unknown placeholder %s", p)
+		}
+		return If(p == "{subject}", "cn=subject", "placeholder")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := NewDN(dn); err != nil {
+		return nil, fmt.Errorf("invalid client certificate mapping: %w", err)
+	}
+	return &ClientCertMapping{template: tmpl}, nil
+}
+
+// DN returns the DN that cert maps to, or an error if cert has no value for
+// a placeholder of the mapping or the result is not a valid DN.
+func (m *ClientCertMapping) DN(cert *x509.Certificate) (DN, error) {
+	var err error
+	dn := clientCertPlaceholder.ReplaceAllStringFunc(m.template, func(p string) string {
+		val := clientCertValues[p](cert)
+		if val == "" {
+			err = fmt.Errorf("client certificate has no value for %s", p)
+		}
+		return If(p == "{subject}", val, escapeDNValue(val))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewDN(dn)
+}
+
+// first returns the first of vals, or "" if there are none.
+func first(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// testCert is a certificate and its private key for tests.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert returns a certificate for the template tmpl signed by parent,
+// or self-signed if parent is nil. The serial number, validity and key
+// usage are filled in if they are not set in tmpl.
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	is := is.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if tmpl.KeyUsage == 0 {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	is.NoErr(err)
+	cert, err := x509.ParseCertificate(der)
+	is.NoErr(err)
+	return &testCert{cert: cert, key: key}
+}
+
+// newTestServerCert returns a self-signed certificate for a server on
+// localhost.
+func newTestServerCert(t *testing.T) *testCert {
+	t.Helper()
+	return newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, nil)
+}
+
+// writeFiles writes the certificate and key of c as PEM files in dir, named
+// from name, and returns their paths.
+func (c *testCert) writeFiles(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	is := is.New(t)
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	is.NoErr(err)
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	is.NoErr(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	is.NoErr(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// pool returns a certificate pool with the certificate of c.
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// tlsConfig returns a TLS configuration for serving with c.
+func (c *testCert) tlsConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	certFile, keyFile := c.writeFiles(t, t.TempDir(), "server")
+	cert, err := NewTLSCertificate(certFile, keyFile)
+	is.New(t).NoErr(err)
+	return NewTLSConfig(cert)
+}
+
+func Test_NewTLSConfig(t *testing.T) {
+	is := is.New(t)
+	cert := newTestServerCert(t)
+
+	config := cert.tlsConfig(t)
+	is.Equal(uint16(tls.VersionTLS12), config.MinVersion)
+	got, err := config.GetCertificate(nil)
+	is.NoErr(err)
+	is.Equal(cert.cert.Raw, got.Certificate[0])
+	for _, id := range config.CipherSuites {
+		for _, insecure := range tls.InsecureCipherSuites() {
+			is.True(id != insecure.ID) // insecure cipher suite allowed
+		}
+	}
+}
+
+func Test_LoadCertPool(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	cert := newTestServerCert(t)
+	certFile, keyFile := cert.writeFiles(t, dir, "ca")
+
+	pool, err := LoadCertPool(certFile)
+	is.NoErr(err)
+	is.True(pool.Equal(cert.pool()))
+
+	_, err = LoadCertPool(keyFile)
+	is.True(err != nil) // no certificates
+	_, err = LoadCertPool(filepath.Join(dir, "missing.crt"))
+	is.True(err != nil)
+}
+
+func Test_ClientCertMapping(t *testing.T) {
+	type testcase struct {
+		template string
+		cert     *x509.Certificate
+		want     string
+		wantErr  bool
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		m, err := NewClientCertMapping(tt.template)
+		is.NoErr(err)
+		cert := newTestCert(t, tt.cert, nil)
+		got, err := m.DN(cert.cert)
+		if tt.wantErr {
+			is.True(err != nil) // expected error
+			return
+		}
+		is.NoErr(err)
+		is.Equal(tt.want, got.String())
+	}
+
+	tests := map[string]testcase{
+		"subject": {
+			template: "{subject}",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job", Organization: []string{"Example"}}},
+			want:     "CN=job,O=Example",
+		},
+		"subject suffix": {
+			template: "{subject},dc=example,dc=com",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job"}},
+			want:     "CN=job,dc=example,dc=com",
+		},
+		"cn": {
+			template: "uid={cn},ou=people,dc=example,dc=com",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job"}},
+			want:     "uid=job,ou=people,dc=example,dc=com",
+		},
+		"cn escaped": {
+			template: "uid={cn},ou=people,dc=example,dc=com",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job,ou=admins"}},
+			want:     `uid=job\,ou=admins,ou=people,dc=example,dc=com`,
+		},
+		"email": {
+			template: "mail={email},dc=example,dc=com",
+			cert:     &x509.Certificate{EmailAddresses: []string{"job@example.com", "other@example.com"}},
+			want:     "mail=job@example.com,dc=example,dc=com",
+		},
+		"dns": {
+			template: "cn={dns},ou=hosts,dc=example,dc=com",
+			cert:     &x509.Certificate{DNSNames: []string{"host.example.com"}},
+			want:     "cn=host.example.com,ou=hosts,dc=example,dc=com",
+		},
+		"missing cn": {
+			template: "uid={cn},dc=example,dc=com",
+			cert:     &x509.Certificate{DNSNames: []string{"host.example.com"}},
+			wantErr:  true,
+		},
+		"missing email": {
+			template: "mail={email},dc=example,dc=com",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job"}},
+			wantErr:  true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_NewClientCertMapping_Invalid(t *testing.T) {
+	is := is.New(t)
+	for _, tmpl := range []string{"uid={uid},dc=example,dc=com", "{cn}", "dc=example,,{cn}", ""} {
+		_, err := NewClientCertMapping(tmpl)
+		is.True(err != nil) // invalid template accepted
+	}
+}
+
+func Test_NewTLSCertificate_Invalid(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	certFile, keyFile := newTestServerCert(t).writeFiles(t, dir, "server")
+
+	_, err := NewTLSCertificate(keyFile, certFile)
+	is.True(err != nil)
+	_, err = NewTLSCertificate(filepath.Join(dir, "missing.crt"), keyFile)
+	is.True(err != nil)
+}
+
+func Test_TLSCertificate_Reload(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	old, rotated := newTestServerCert(t), newTestServerCert(t)
+	certFile, keyFile := old.writeFiles(t, dir, "server")
+	c, err := NewTLSCertificate(certFile, keyFile)
+	is.NoErr(err)
+	current := func() *x509.Certificate {
+		cert, err := c.GetCertificate(nil)
+		is.NoErr(err)
+		return cert.Leaf
+	}
+
+	changed, err := c.reload()
+	is.NoErr(err)
+	is.True(!changed) // reloaded unchanged files
+	is.Equal(old.cert.SerialNumber, current().SerialNumber)
+
+	// A certificate that does not match the key is not loaded, as when only
+	// the certificate file has been rotated so far.
+	keyPEM, err := os.ReadFile(keyFile)
+	is.NoErr(err)
+	rotated.writeFiles(t, dir, "server")
+	is.NoErr(os.WriteFile(keyFile, keyPEM, 0o600))
+	_, err = c.reload()
+	is.True(err != nil)
+	is.Equal(old.cert.SerialNumber, current().SerialNumber)
+
+	rotated.writeFiles(t, dir, "server")
+	changed, err = c.reload()
+	is.NoErr(err)
+	is.True(changed)
+	is.Equal(rotated.cert.SerialNumber, current().SerialNumber)
+}
+
+func Test_TLSCertificate_Watch(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	old, rotated := newTestServerCert(t), newTestServerCert(t)
+	certFile, keyFile := old.writeFiles(t, dir, "server")
+	c, err := NewTLSCertificate(certFile, keyFile)
+	is.NoErr(err)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		c.Watch(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	rotated.writeFiles(t, dir, "server")
+	for i := 0; i < 100 && c.cert.Load().Leaf.SerialNumber.Cmp(rotated.cert.SerialNumber) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(rotated.cert.SerialNumber, c.cert.Load().Leaf.SerialNumber)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jimlambrt/gldap"
+)
+
+// ModOp is the operation of a [Modification]. Its values are those of the
+// operation of a change in an LDAP Modify request.
+type ModOp int
+
+const (
+	// ModAdd adds the values of the modification to the attribute,
+	// creating the attribute if necessary.
+	ModAdd ModOp = iota
+	// ModDelete deletes the values of the modification from the attribute,
+	// or the whole attribute if there are no values.
+	ModDelete
+	// ModReplace replaces all the values of the attribute with the values
+	// of the modification, deleting the attribute if there are none.
+	ModReplace
+)
+
+// Modification is a change to a single attribute of an entry made by
+// [DB.Modify], as described in [RFC 4511, section 4.6].
+//
+// [RFC 4511, section 4.6]: https://datatracker.ietf.org/doc/html/rfc4511#section-4.6
+type Modification struct {
+	Op   ModOp
+	Attr Attr
+}
+
+// Add adds e to the database with the origin [OriginLDAP]. It is added as
+// with [DB.AddEntries], except that the parent of e must exist, unless e is at
+// the top of the DIT, e must have an objectClass, attributes that are not
+// user-modifiable (see [AttributeType]) cannot be given, and an entry with
+// the same DN is an error whatever its origin.
+//
+// If the parent does not exist, an error wrapping [ErrOrphanEntry] is
+// returned. If e has no objectClass, an error wrapping [ErrSchemaViolation]
+// is returned. Other errors are as for [DB.AddEntries] or wrap an
+// [LDAPError].
+// [ResultCode] returns the LDAP result code for all of them.
+//
+// Add, like the other methods that change entries, saves the change to the
+// Store of the DB, if it has one. If the change cannot be saved, it is not
+// made.
+func (db *DB) Add(e *Entry) error {
+	for _, a := range e.Attrs {
+		if err := checkUserModifiable(a.Name); err != nil {
+			return err
+		}
+	}
+	if len(e.DN) > 1 && db.DIT.Find(e.DN[:len(e.DN)-1]) == nil {
+		return fmt.Errorf("%w: %s: parent %s does not exist", ErrOrphanEntry, e.DN, e.DN[:len(e.DN)-1])
+	}
+	if db.DIT.Find(e.DN) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateDN, e.DN)
+	}
+	if err := e.checkRequired(); err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+	}
+	e.Origin = OriginLDAP
+	if err := db.AddEntries([]*Entry{e}); err != nil {
+		return err
+	}
+	if err := db.save(Change{DN: e.DN, Entry: e}); err != nil {
+		db.DIT.remove(db.DIT.Find(e.DN))
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the entry with the given DN from the database. Only entries
+// without children can be deleted. The root DSE and subschema subentry
+// cannot be deleted. Errors wrap an [LDAPError] with the result code of the
+// failure.
+func (db *DB) Delete(dn DN) error {
+	node, err := db.findModifiable(dn)
+	if err != nil {
+		return err
+	}
+	if len(node.children) > 0 {
+		return fmt.Errorf("%w: %s has children", LDAPError(gldap.ResultNotAllowedOnNonLeaf), dn)
+	}
+	if err := db.save(Change{DN: node.Entry.DN}); err != nil {
+		return err
+	}
+	db.DIT.remove(node)
+	return nil
+}
+
+// Modify applies the modifications mods to the entry with the given DN, in
+// order. Either all the modifications are applied or, if there is an error,
+// none are. The values of the RDN of the entry and all of its object classes
+// cannot be removed, and attributes that are not user-modifiable cannot be
+// modified. If ValidateEntries is set, the modified entry is validated
+// against the schema. The modified entry has the origin [OriginLDAP].
+//
+// Errors wrap [ErrSchemaViolation] if the modified entry is not valid, or
+// otherwise an [LDAPError] with the result code of the failure.
+func (db *DB) Modify(dn DN, mods []Modification) error {
+	node, err := db.findModifiable(dn)
+	if err != nil {
+		return err
+	}
+	e := node.Entry.clone()
+	e.Origin = OriginLDAP
+	for _, m := range mods {
+		if err := e.modify(m); err != nil {
+			return fmt.Errorf("%w: %s", err, dn)
+		}
+	}
+	for _, ava := range e.DN[len(e.DN)-1] {
+		if attr, ok := e.GetAttr(ava.Name); !ok || !attr.HasValue(ava.Value) {
+			return fmt.Errorf("%w: %s: cannot remove RDN value %s", LDAPError(gldap.ResultNotAllowedOnRDN), dn, ava)
+		}
+	}
+	if err := e.checkRequired(); err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+	}
+	if db.ValidateEntries {
+		if err := errors.Join(schema.ValidateEntry(e)...); err != nil {
+			return err
+		}
+	}
+	if err := db.save(Change{DN: e.DN, Entry: e}); err != nil {
+		return err
+	}
+	node.Entry = e
+	return nil
+}
+
+// modify applies the single modification m to e.
+func (e *Entry) modify(m Modification) error {
+	if err := checkUserModifiable(m.Attr.Name); err != nil {
+		return err
+	}
+	key := schema.attrKey(m.Attr.Name)
+	attr, ok := e.Attrs[key]
+	switch m.Op {
+	case ModAdd:
+		if len(m.Attr.Vals) == 0 {
+			return fmt.Errorf("%w: no values to add to %s", LDAPError(gldap.ResultProtocolError), m.Attr.Name)
+		}
+		if !ok {
+			attr = Attr{Name: m.Attr.Name}
+		}
+		for _, v := range m.Attr.Vals {
+			if attr.HasValue(v) {
+				return fmt.Errorf("%w: %s: %s", LDAPError(gldap.ResultAttributeOrValueExists), m.Attr.Name, v)
+			}
+			attr.Vals = append(attr.Vals, v)
+		}
+		e.Attrs[key] = attr
+	case ModDelete:
+		if !ok {
+			return fmt.Errorf("%w: %s", LDAPError(gldap.ResultNoSuchAttribute), m.Attr.Name)
+		}
+		for _, v := range m.Attr.Vals {
+			i := attr.indexValue(v)
+			if i == -1 {
+				return fmt.Errorf("%w: %s: %s", LDAPError(gldap.ResultNoSuchAttribute), m.Attr.Name, v)
+			}
+			attr.Vals = slices.Delete(attr.Vals, i, i+1)
+		}
+		if len(m.Attr.Vals) == 0 || len(attr.Vals) == 0 {
+			delete(e.Attrs, key)
+		} else {
+			e.Attrs[key] = attr
+		}
+	case ModReplace:
+		if len(m.Attr.Vals) == 0 {
+			delete(e.Attrs, key)
+		} else {
+			e.Attrs[key] = Attr{Name: m.Attr.Name, Vals: slices.Clone(m.Attr.Vals)}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported modify operation %d", LDAPError(gldap.ResultUnwillingToPerform), m.Op)
+	}
+	return nil
+}
+
+// ModifyDN renames the entry with the given DN to have the RDN newRDN, and
+// moves it to be a child of newSuperior if it is not nil. The values of
+// newRDN are added to the entry if it does not have them. If deleteOldRDN is
+// true, the values of the old RDN of the entry are deleted from it, unless
+// they are also in newRDN. Only entries without children can be renamed.
+// The renamed entry has the origin [OriginLDAP].
+//
+// Errors wrap [ErrSchemaViolation] if the renamed entry is not valid, or
+// otherwise an [LDAPError] with the result code of the failure.
+func (db *DB) ModifyDN(dn DN, newRDN RDN, deleteOldRDN bool, newSuperior DN) error {
+	node, err := db.findModifiable(dn)
+	if err != nil {
+		return err
+	}
+	if len(node.children) > 0 {
+		return fmt.Errorf("%w: %s has children", LDAPError(gldap.ResultNotAllowedOnNonLeaf), dn)
+	}
+	parent := dn[:len(dn)-1]
+	if newSuperior != nil {
+		if !newSuperior.IsEmpty() && db.DIT.Find(newSuperior) == nil {
+			return fmt.Errorf("%w: new superior %s", LDAPError(gldap.ResultNoSuchObject), newSuperior)
+		}
+		if dn.IsAncestor(newSuperior) {
+			return fmt.Errorf("%w: cannot move %s below itself", LDAPError(gldap.ResultUnwillingToPerform), dn)
+		}
+		parent = newSuperior
+	}
+	newDN := append(slices.Clone(parent), newRDN)
+	if other := db.DIT.Find(newDN); other != nil && other != node {
+		return fmt.Errorf("%w: %s", LDAPError(gldap.ResultEntryAlreadyExists), newDN)
+	}
+
+	e := node.Entry.clone()
+	e.DN = newDN
+	e.Origin = OriginLDAP
+	oldRDN := dn[len(dn)-1]
+	if deleteOldRDN {
+		for _, ava := range oldRDN {
+			if slices.ContainsFunc(newRDN, func(a AVA) bool { return a.Compare(ava) == 0 }) {
+				continue
+			}
+			// A missing value is ignored. It is not there to delete.
+			m := Modification{Op: ModDelete, Attr: Attr{Name: ava.Name, Vals: []string{ava.Value}}}
+			if err := e.modify(m); err != nil && !errors.Is(err, LDAPError(gldap.ResultNoSuchAttribute)) {
+				return fmt.Errorf("%w: %s", err, dn)
+			}
+		}
+	}
+	for _, ava := range newRDN {
+		if attr, ok := e.GetAttr(ava.Name); !ok || !attr.HasValue(ava.Value) {
+			attr.Name = cmp.Or(attr.Name, ava.Name)
+			attr.Vals = append(attr.Vals, ava.Value)
+			e.AddAttr(attr)
+		}
+	}
+	if db.ValidateEntries {
+		if err := errors.Join(schema.ValidateEntry(e)...); err != nil {
+			return err
+		}
+	}
+
+	if err := db.save(Change{DN: node.Entry.DN}, Change{DN: e.DN, Entry: e}); err != nil {
+		return err
+	}
+	db.DIT.remove(node)
+	return db.DIT.insert(e)
+}
+
+// findModifiable returns the node of the entry with the given DN if it can be
+// modified or deleted. The root DSE, the subschema subentry and entries with
+// the origin [OriginStatic] cannot be.
+func (db *DB) findModifiable(dn DN) (*DITNode, error) {
+	if dn.IsEmpty() || db.isSubschema(dn) {
+		return nil, fmt.Errorf("%w: %s cannot be modified", LDAPError(gldap.ResultUnwillingToPerform), dn)
+	}
+	node := db.DIT.Find(dn)
+	if node == nil {
+		return nil, fmt.Errorf("%w: %s", LDAPError(gldap.ResultNoSuchObject), dn)
+	}
+	if node.Entry.Origin == OriginStatic {
+		return nil, fmt.Errorf("%w: %s is static", LDAPError(gldap.ResultUnwillingToPerform), dn)
+	}
+	return node, nil
+}
+
+// checkUserModifiable returns an error if the attribute type of the named
+// attribute is not user-modifiable.
+func checkUserModifiable(name string) error {
+	if at := schema.AttributeType(name); at != nil && at.NoUserModification {
+		return fmt.Errorf("%w: %s is not user-modifiable", LDAPError(gldap.ResultConstraintViolation), name)
+	}
+	return nil
+}
+
+// remove removes node from the DIT below dit.
+func (dit *DITNode) remove(node *DITNode) {
+	for i, child := range dit.children {
+		if child == node {
+			dit.children = slices.Delete(dit.children, i, i+1)
+			return
+		}
+		if child.isAncestorOf(node.norm) {
+			child.remove(node)
+			return
+		}
+	}
+}
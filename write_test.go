@@ -0,0 +1,484 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/matryer/is"
+)
+
+// newWriteTestDB returns a DB with a small tree of entries to modify. The
+// top entry is static and the others are from files:
+//
+//	dc=example,dc=com
+//	  ou=people
+//	    uid=alice
+//	  cn=admins
+//	  cn=static
+func newWriteTestDB(t *testing.T) *DB {
+	t.Helper()
+	db := NewDB()
+	err := db.AddEntries([]*Entry{
+		{DN: MustDN(t, "dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"domain"}},
+			"dc":          {"dc", []string{"example"}},
+		}},
+		{DN: MustDN(t, "cn=static,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"applicationProcess"}},
+			"cn":          {"cn", []string{"static"}},
+		}},
+	})
+	is.New(t).NoErr(err)
+	files := []*Entry{
+		{DN: MustDN(t, "ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"organizationalUnit"}},
+			"ou":          {"ou", []string{"people"}},
+		}},
+		{DN: MustDN(t, "uid=alice,ou=people,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"inetOrgPerson"}},
+			"uid":         {"uid", []string{"alice"}},
+			"cn":          {"cn", []string{"Alice"}},
+			"sn":          {"sn", []string{"Smith"}},
+			"mail":        {"mail", []string{"alice@example.com", "as@example.com"}},
+		}},
+		{DN: MustDN(t, "cn=admins,dc=example,dc=com"), Attrs: map[string]Attr{
+			"objectclass": {"objectClass", []string{"groupOfNames"}},
+			"cn":          {"cn", []string{"admins"}},
+			"member":      {"member", []string{"uid=alice,ou=people,dc=example,dc=com"}},
+		}},
+	}
+	for _, e := range files {
+		e.Origin = OriginFiles
+	}
+	is.New(t).NoErr(db.AddEntries(files))
+	return db
+}
+
+func Test_ResultCode(t *testing.T) {
+	type testcase struct {
+		err  error
+		want int
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		is.Equal(tt.want, ResultCode(tt.err))
+	}
+
+	tests := map[string]testcase{
+		"nil":              {err: nil, want: gldap.ResultSuccess},
+		"ldap error":       {err: LDAPError(gldap.ResultNoSuchObject), want: gldap.ResultNoSuchObject},
+		"wrapped":          {err: fmt.Errorf("%w: x", LDAPError(gldap.ResultNotAllowedOnNonLeaf)), want: gldap.ResultNotAllowedOnNonLeaf},
+		"duplicate":        {err: fmt.Errorf("%w: x", ErrDuplicateDN), want: gldap.ResultEntryAlreadyExists},
+		"orphan":           {err: fmt.Errorf("%w: x", ErrOrphanEntry), want: gldap.ResultNoSuchObject},
+		"schema violation": {err: errors.Join(fmt.Errorf("%w: x", ErrSchemaViolation)), want: gldap.ResultObjectClassViolation},
+		"other":            {err: errors.New("x"), want: gldap.ResultOther},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DBAdd(t *testing.T) {
+	type testcase struct {
+		entry    map[string]any
+		without  string // attribute removed from the entry before adding it
+		validate bool
+		want     int
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		db.ValidateEntries = tt.validate
+		e, err := NewEntryFromMap(tt.entry)
+		is.NoErr(err)
+		delete(e.Attrs, schema.attrKey(tt.without))
+		err = db.Add(e)
+		is.Equal(tt.want, ResultCode(err))
+		if err == nil {
+			node := db.DIT.Find(e.DN)
+			is.True(node != nil)
+			is.Equal(OriginLDAP, node.Entry.Origin)
+		}
+	}
+
+	tests := map[string]testcase{
+		"success": {
+			entry: map[string]any{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Bob", "sn": "Jones"},
+			want:  gldap.ResultSuccess,
+		},
+		"success validated": {
+			entry:    map[string]any{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Bob", "sn": "Jones"},
+			validate: true,
+			want:     gldap.ResultSuccess,
+		},
+		"exists": {
+			entry: map[string]any{"dn": "UID=Alice,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Alice", "sn": "Smith"},
+			want:  gldap.ResultEntryAlreadyExists,
+		},
+		"exists static": {
+			entry: map[string]any{"dn": "cn=static,dc=example,dc=com", "objectClass": "applicationProcess"},
+			want:  gldap.ResultEntryAlreadyExists,
+		},
+		"no parent": {
+			entry: map[string]any{"dn": "uid=bob,ou=staff,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Bob", "sn": "Jones"},
+			want:  gldap.ResultNoSuchObject,
+		},
+		"invalid": {
+			entry:    map[string]any{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Bob"},
+			validate: true,
+			want:     gldap.ResultObjectClassViolation,
+		},
+		"no user modification": {
+			entry: map[string]any{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "cn": "Bob", "sn": "Jones", "createTimestamp": "20250101000000Z"},
+			want:  gldap.ResultConstraintViolation,
+		},
+		"no objectClass": {
+			entry:   map[string]any{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "inetOrgPerson", "uid": "bob"},
+			without: "objectClass",
+			want:    gldap.ResultObjectClassViolation,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DBDelete(t *testing.T) {
+	type testcase struct {
+		dn   string
+		want int
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		dn := MustDN(t, tt.dn)
+		err := db.Delete(dn)
+		is.Equal(tt.want, ResultCode(err))
+		if err == nil {
+			is.Equal(db.DIT.Find(dn), nil)
+			is.True(db.DIT.Find(dn[:len(dn)-1]) != nil) // parent not deleted
+		}
+	}
+
+	tests := map[string]testcase{
+		"leaf":             {dn: "uid=alice,ou=people,dc=example,dc=com", want: gldap.ResultSuccess},
+		"leaf ignore case": {dn: "CN=Admins,DC=example,DC=com", want: gldap.ResultSuccess},
+		"non-leaf":         {dn: "ou=people,dc=example,dc=com", want: gldap.ResultNotAllowedOnNonLeaf},
+		"no such object":   {dn: "uid=bob,ou=people,dc=example,dc=com", want: gldap.ResultNoSuchObject},
+		"static":           {dn: "cn=static,dc=example,dc=com", want: gldap.ResultUnwillingToPerform},
+		"root dse":         {dn: "", want: gldap.ResultUnwillingToPerform},
+		"subschema":        {dn: "cn=subschema", want: gldap.ResultUnwillingToPerform},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DBModify(t *testing.T) {
+	type testcase struct {
+		dn       string
+		mods     []Modification
+		validate bool
+		want     int
+		wantAttr Attr // checked if want is success
+	}
+
+	mod := func(op ModOp, name string, vals ...string) Modification {
+		return Modification{Op: op, Attr: Attr{Name: name, Vals: vals}}
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		db.ValidateEntries = tt.validate
+		dn := MustDN(t, tt.dn)
+		before := db.DIT.Find(dn)
+		var beforeEntry *Entry
+		if before != nil {
+			beforeEntry = before.Entry.clone()
+		}
+		err := db.Modify(dn, tt.mods)
+		is.Equal(tt.want, ResultCode(err))
+		if err != nil {
+			if before != nil {
+				is.Equal(beforeEntry, before.Entry) // entry unchanged on error
+			}
+			return
+		}
+		is.Equal(OriginLDAP, db.DIT.Find(dn).Entry.Origin)
+		got, ok := db.DIT.Find(dn).Entry.GetAttr(tt.wantAttr.Name)
+		if tt.wantAttr.Vals == nil {
+			is.True(!ok)
+			return
+		}
+		is.Equal(tt.wantAttr, got)
+	}
+
+	alice := "uid=alice,ou=people,dc=example,dc=com"
+	tests := map[string]testcase{
+		"add value": {
+			dn:       alice,
+			mods:     []Modification{mod(ModAdd, "mail", "alice2@example.com")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"mail", []string{"alice@example.com", "as@example.com", "alice2@example.com"}},
+		},
+		"add attribute": {
+			dn:       alice,
+			mods:     []Modification{mod(ModAdd, "description", "A person")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"description", []string{"A person"}},
+		},
+		"add existing value": {
+			dn:   alice,
+			mods: []Modification{mod(ModAdd, "mail", "ALICE@example.com")},
+			want: gldap.ResultAttributeOrValueExists,
+		},
+		"delete value": {
+			dn:       alice,
+			mods:     []Modification{mod(ModDelete, "mail", "AS@example.com")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"mail", []string{"alice@example.com"}},
+		},
+		"delete attribute": {
+			dn:       alice,
+			mods:     []Modification{mod(ModDelete, "mail")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{Name: "mail"},
+		},
+		"delete missing value": {
+			dn:   alice,
+			mods: []Modification{mod(ModDelete, "mail", "bob@example.com")},
+			want: gldap.ResultNoSuchAttribute,
+		},
+		"delete missing attribute": {
+			dn:   alice,
+			mods: []Modification{mod(ModDelete, "description")},
+			want: gldap.ResultNoSuchAttribute,
+		},
+		"replace": {
+			dn:       alice,
+			mods:     []Modification{mod(ModReplace, "mail", "a@example.com")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"mail", []string{"a@example.com"}},
+		},
+		"replace with nothing": {
+			dn:       alice,
+			mods:     []Modification{mod(ModReplace, "mail")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{Name: "mail"},
+		},
+		"replace missing with nothing": {
+			dn:       alice,
+			mods:     []Modification{mod(ModReplace, "description")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{Name: "description"},
+		},
+		"several": {
+			dn: alice,
+			mods: []Modification{
+				mod(ModDelete, "mail"),
+				mod(ModAdd, "mail", "a@example.com"),
+				mod(ModAdd, "mail", "b@example.com"),
+			},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"mail", []string{"a@example.com", "b@example.com"}},
+		},
+		"atomic": {
+			dn: alice,
+			mods: []Modification{
+				mod(ModReplace, "mail", "a@example.com"),
+				mod(ModDelete, "description"),
+			},
+			want: gldap.ResultNoSuchAttribute,
+		},
+		"rdn value": {
+			dn:   alice,
+			mods: []Modification{mod(ModReplace, "uid", "bob")},
+			want: gldap.ResultNotAllowedOnRDN,
+		},
+		"no user modification": {
+			dn:   alice,
+			mods: []Modification{mod(ModReplace, "createTimestamp", "20250101000000Z")},
+			want: gldap.ResultConstraintViolation,
+		},
+		"schema violation": {
+			dn:       alice,
+			mods:     []Modification{mod(ModDelete, "sn")},
+			validate: true,
+			want:     gldap.ResultObjectClassViolation,
+		},
+		"delete objectClass": {
+			dn:   alice,
+			mods: []Modification{mod(ModDelete, "objectClass")},
+			want: gldap.ResultObjectClassViolation,
+		},
+		"delete objectClass values": {
+			dn:   alice,
+			mods: []Modification{mod(ModDelete, "objectClass", "inetOrgPerson")},
+			want: gldap.ResultObjectClassViolation,
+		},
+		"replace objectClass with nothing": {
+			dn:   alice,
+			mods: []Modification{mod(ModReplace, "objectClass")},
+			want: gldap.ResultObjectClassViolation,
+		},
+		"replace objectClass": {
+			dn:       alice,
+			mods:     []Modification{mod(ModReplace, "objectClass", "account")},
+			want:     gldap.ResultSuccess,
+			wantAttr: Attr{"objectClass", []string{"account"}},
+		},
+		"no such object": {
+			dn:   "uid=bob,ou=people,dc=example,dc=com",
+			mods: []Modification{mod(ModAdd, "mail", "bob@example.com")},
+			want: gldap.ResultNoSuchObject,
+		},
+		"static": {
+			dn:   "cn=static,dc=example,dc=com",
+			mods: []Modification{mod(ModAdd, "description", "x")},
+			want: gldap.ResultUnwillingToPerform,
+		},
+		"subschema": {
+			dn:   "cn=subschema",
+			mods: []Modification{mod(ModAdd, "description", "x")},
+			want: gldap.ResultUnwillingToPerform,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}
+
+func Test_DBModifyDN(t *testing.T) {
+	type testcase struct {
+		dn           string
+		newRDN       string
+		deleteOldRDN bool
+		newSuperior  string // nil if empty
+		want         int
+		wantDN       string // checked if want is success
+		wantAttrs    []Attr // checked if want is success
+	}
+
+	testfunc := func(t *testing.T, tt testcase) { //nolint:thelper // not a helper
+		is := is.New(t)
+		db := newWriteTestDB(t)
+		db.ValidateEntries = true
+		rdn, err := ParseRDN(tt.newRDN)
+		is.NoErr(err)
+		var newSuperior DN
+		if tt.newSuperior != "" {
+			newSuperior = MustDN(t, tt.newSuperior)
+		}
+		dn := MustDN(t, tt.dn)
+		before := db.DIT.Find(dn)
+		err = db.ModifyDN(dn, rdn, tt.deleteOldRDN, newSuperior)
+		is.Equal(tt.want, ResultCode(err))
+		if err != nil {
+			is.Equal(before, db.DIT.Find(dn)) // entry not moved on error
+			return
+		}
+		wantDN := MustDN(t, tt.wantDN)
+		if !dn.Equal(wantDN) {
+			is.Equal(db.DIT.Find(dn), nil)
+		}
+		node := db.DIT.Find(wantDN)
+		is.True(node != nil)
+		is.Equal(tt.wantDN, node.Entry.DN.String())
+		is.Equal(OriginLDAP, node.Entry.Origin)
+		for _, want := range tt.wantAttrs {
+			got, ok := node.Entry.GetAttr(want.Name)
+			if want.Vals == nil {
+				is.True(!ok)
+				continue
+			}
+			is.Equal(want, got)
+		}
+	}
+
+	tests := map[string]testcase{
+		"rename": {
+			dn:        "cn=admins,dc=example,dc=com",
+			newRDN:    "cn=wheel",
+			want:      gldap.ResultSuccess,
+			wantDN:    "cn=wheel,dc=example,dc=com",
+			wantAttrs: []Attr{{"cn", []string{"admins", "wheel"}}},
+		},
+		"rename delete old rdn": {
+			dn:           "cn=admins,dc=example,dc=com",
+			newRDN:       "cn=wheel",
+			deleteOldRDN: true,
+			want:         gldap.ResultSuccess,
+			wantDN:       "cn=wheel,dc=example,dc=com",
+			wantAttrs:    []Attr{{"cn", []string{"wheel"}}},
+		},
+		"rename change case": {
+			dn:           "cn=admins,dc=example,dc=com",
+			newRDN:       "cn=Admins",
+			deleteOldRDN: true,
+			want:         gldap.ResultSuccess,
+			wantDN:       "cn=Admins,dc=example,dc=com",
+			wantAttrs:    []Attr{{"cn", []string{"admins"}}},
+		},
+		"rename new attribute": {
+			dn:           "uid=alice,ou=people,dc=example,dc=com",
+			newRDN:       "cn=Alice Smith",
+			deleteOldRDN: false,
+			want:         gldap.ResultSuccess,
+			wantDN:       "cn=Alice Smith,ou=people,dc=example,dc=com",
+			wantAttrs:    []Attr{{"cn", []string{"Alice", "Alice Smith"}}, {"uid", []string{"alice"}}},
+		},
+		"move": {
+			dn:          "uid=alice,ou=people,dc=example,dc=com",
+			newRDN:      "uid=alice",
+			newSuperior: "dc=example,dc=com",
+			want:        gldap.ResultSuccess,
+			wantDN:      "uid=alice,dc=example,dc=com",
+			wantAttrs:   []Attr{{"uid", []string{"alice"}}},
+		},
+		"exists": {
+			dn:     "cn=admins,dc=example,dc=com",
+			newRDN: "ou=People",
+			want:   gldap.ResultEntryAlreadyExists,
+		},
+		"non-leaf": {
+			dn:     "ou=people,dc=example,dc=com",
+			newRDN: "ou=staff",
+			want:   gldap.ResultNotAllowedOnNonLeaf,
+		},
+		"no such object": {
+			dn:     "cn=users,dc=example,dc=com",
+			newRDN: "cn=wheel",
+			want:   gldap.ResultNoSuchObject,
+		},
+		"no such superior": {
+			dn:          "cn=admins,dc=example,dc=com",
+			newRDN:      "cn=admins",
+			newSuperior: "ou=groups,dc=example,dc=com",
+			want:        gldap.ResultNoSuchObject,
+		},
+		"schema violation": {
+			dn:     "cn=admins,dc=example,dc=com",
+			newRDN: "uid=admins",
+			want:   gldap.ResultObjectClassViolation,
+		},
+		"static": {
+			dn:     "cn=static,dc=example,dc=com",
+			newRDN: "cn=dynamic",
+			want:   gldap.ResultUnwillingToPerform,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) { testfunc(t, tt) })
+	}
+}